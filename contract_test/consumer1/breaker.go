@@ -0,0 +1,215 @@
+package consumer1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the API while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// StateClosed lets every request through
+	StateClosed CircuitState = iota
+	// StateOpen rejects every request with ErrCircuitOpen
+	StateOpen
+	// StateHalfOpen lets a few probe requests through to test the API
+	StateHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerSettings configures a CircuitBreaker
+type BreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before probing
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of probes let through while half-open,
+	// all of them must succeed to close the circuit
+	HalfOpenProbes int
+	// OnStateChange is called on every transition, e.g. for logging or metrics
+	OnStateChange func(from, to CircuitState)
+}
+
+// DefaultBreakerSettings opens after 5 failures for 30 seconds
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+		HalfOpenProbes:   1,
+	}
+}
+
+// CircuitBreaker stops calling the API after repeated failures, a failure
+// is a connection error or a 429 or 5xx response
+type CircuitBreaker struct {
+	settings BreakerSettings
+	now      func() time.Time
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	probes    int
+	successes int
+	openedAt  time.Time
+	// generation changes with every transition, the outcome of a request
+	// allowed in an earlier generation is ignored
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	if settings.FailureThreshold < 1 {
+		settings.FailureThreshold = 1
+	}
+	if settings.HalfOpenProbes < 1 {
+		settings.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{settings: settings, now: time.Now}
+}
+
+// WithCircuitBreaker guards every request with the circuit breaker,
+// the same breaker can be shared by several clients of one API
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(c *Client) {
+		c.breaker = breaker
+	}
+}
+
+// State returns the current state of the circuit
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.OpenDuration {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a request may be sent, and returns the generation
+// to record its outcome with
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	from := b.state
+
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.settings.OpenDuration {
+			b.mu.Unlock()
+			return 0, ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.probes >= b.settings.HalfOpenProbes {
+			b.mu.Unlock()
+			b.notify(from, StateHalfOpen)
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+
+	to, generation := b.state, b.generation
+	b.mu.Unlock()
+	b.notify(from, to)
+	return generation, nil
+}
+
+// outcome of a request as seen by the breaker
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is a request cancelled by the caller
+	outcomeIgnored
+)
+
+func requestOutcome(ctx context.Context, resp *http.Response, err error) outcome {
+	if err != nil {
+		if ctx.Err() != nil {
+			return outcomeIgnored
+		}
+		return outcomeFailure
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// record updates the circuit with the outcome of a request allowed in
+// generation. A request allowed before the last transition took no probe
+// and says nothing about the current state, its outcome is ignored.
+func (b *CircuitBreaker) record(generation uint64, result outcome) {
+	b.mu.Lock()
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+	from := b.state
+
+	switch b.state {
+	case StateClosed:
+		switch result {
+		case outcomeSuccess:
+			b.failures = 0
+		case outcomeFailure:
+			b.failures++
+			if b.failures >= b.settings.FailureThreshold {
+				b.setState(StateOpen)
+			}
+		}
+	case StateHalfOpen:
+		b.probes--
+		switch result {
+		case outcomeSuccess:
+			b.successes++
+			if b.successes >= b.settings.HalfOpenProbes {
+				b.setState(StateClosed)
+			}
+		case outcomeFailure:
+			b.setState(StateOpen)
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// setState resets the counters of the new state and starts a new
+// generation, the caller must hold the lock
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+}
+
+func (b *CircuitBreaker) notify(from, to CircuitState) {
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,218 @@
+package consumer1_test
+
+import (
+	"consumer1"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// transitions records the state changes of a circuit breaker
+type transitions struct {
+	mu     sync.Mutex
+	states []consumer1.CircuitState
+}
+
+func (tr *transitions) record(from, to consumer1.CircuitState) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.states = append(tr.states, to)
+}
+
+func (tr *transitions) get() []consumer1.CircuitState {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]consumer1.CircuitState(nil), tr.states...)
+}
+
+func TestClientUnit_CircuitBreakerOpens(t *testing.T) {
+	// Setup mock server that is down
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// Setup client
+	var changes transitions
+	breaker := consumer1.NewCircuitBreaker(consumer1.BreakerSettings{
+		FailureThreshold: 2,
+		OpenDuration:     time.Minute,
+		OnStateChange:    changes.record,
+	})
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+
+	// Act
+	_, err1 := client.GetProduct(context.Background(), 1)
+	_, err2 := client.GetProduct(context.Background(), 1)
+	_, err3 := client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.NotErrorIs(t, err1, consumer1.ErrCircuitOpen)
+	assert.NotErrorIs(t, err2, consumer1.ErrCircuitOpen)
+	assert.ErrorIs(t, err3, consumer1.ErrCircuitOpen)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, consumer1.StateOpen, breaker.State())
+	assert.Equal(t, []consumer1.CircuitState{consumer1.StateOpen}, changes.get())
+}
+
+func TestClientUnit_CircuitBreakerIgnoresClientErrors(t *testing.T) {
+	// Setup mock server without products
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Setup client
+	breaker := consumer1.NewCircuitBreaker(consumer1.BreakerSettings{FailureThreshold: 1, OpenDuration: time.Minute})
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+
+	// Act
+	for i := 0; i < 3; i++ {
+		_, err = client.GetProduct(context.Background(), 1)
+		assert.ErrorIs(t, err, consumer1.ErrNotFound)
+	}
+
+	// Assert
+	assert.Equal(t, consumer1.StateClosed, breaker.State())
+}
+
+func TestClientUnit_CircuitBreakerRecovers(t *testing.T) {
+	// Setup mock server that fails once then recovers
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		product, _ := json.Marshal(model.Product{ID: 1, ProductName: "Test Product"})
+		rw.Write([]byte(product))
+	}))
+	defer server.Close()
+
+	// Setup client
+	var changes transitions
+	breaker := consumer1.NewCircuitBreaker(consumer1.BreakerSettings{
+		FailureThreshold: 1,
+		OpenDuration:     20 * time.Millisecond,
+		HalfOpenProbes:   2,
+		OnStateChange:    changes.record,
+	})
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.Error(t, err)
+	assert.Equal(t, consumer1.StateOpen, breaker.State())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, consumer1.StateHalfOpen, breaker.State())
+
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, consumer1.StateClosed, breaker.State())
+	assert.Equal(t, []consumer1.CircuitState{
+		consumer1.StateOpen, consumer1.StateHalfOpen, consumer1.StateClosed,
+	}, changes.get())
+}
+
+func TestClientUnit_CircuitBreakerProbeFails(t *testing.T) {
+	// Setup mock server that is down
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Setup client
+	breaker := consumer1.NewCircuitBreaker(consumer1.BreakerSettings{
+		FailureThreshold: 1,
+		OpenDuration:     20 * time.Millisecond,
+	})
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.Error(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.NotErrorIs(t, err, consumer1.ErrCircuitOpen)
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.ErrorIs(t, err, consumer1.ErrCircuitOpen)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, consumer1.StateOpen, breaker.State())
+}
+
+func TestClientUnit_CircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	// Setup mock server where product 1 answers once released, and product 2 is down
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/v1/products/2" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		<-release
+		product, _ := json.Marshal(model.Product{ID: 1, ProductName: "Test Product"})
+		rw.Write([]byte(product))
+	}))
+	defer server.Close()
+
+	// Setup client
+	breaker := consumer1.NewCircuitBreaker(consumer1.BreakerSettings{
+		FailureThreshold: 1,
+		OpenDuration:     20 * time.Millisecond,
+	})
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+
+	// Act, a slow request allowed while closed finishes while half-open
+	slow := make(chan error)
+	go func() {
+		_, err := client.GetProduct(context.Background(), 1)
+		slow <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err = client.GetProduct(context.Background(), 2)
+	assert.Error(t, err)
+	assert.Equal(t, consumer1.StateOpen, breaker.State())
+
+	time.Sleep(30 * time.Millisecond)
+	probe := make(chan error)
+	go func() {
+		_, err := client.GetProduct(context.Background(), 1)
+		probe <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	release <- struct{}{}
+	assert.NoError(t, <-slow)
+
+	// Assert, the probe slot is still taken and the circuit is not closed
+	assert.Equal(t, consumer1.StateHalfOpen, breaker.State())
+	_, err = client.GetProduct(context.Background(), 2)
+	assert.ErrorIs(t, err, consumer1.ErrCircuitOpen)
+
+	release <- struct{}{}
+	assert.NoError(t, <-probe)
+	assert.Equal(t, consumer1.StateClosed, breaker.State())
+}
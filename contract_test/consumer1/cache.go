@@ -0,0 +1,151 @@
+package consumer1
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ResponseCache keeps the responses of GET requests in memory and
+// revalidates them with If-None-Match and If-Modified-Since, a 304 answer
+// is served from the cache. Only share a cache between clients sending
+// the same credentials.
+type ResponseCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// cacheEntry is a stored response with its validators
+type cacheEntry struct {
+	key    string
+	header http.Header
+	body   []byte
+}
+
+// NewResponseCache creates a cache holding up to maxEntries responses,
+// the least recently used one is evicted first, zero means no limit
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// WithCache stores the responses of GET requests in the cache
+func WithCache(cache *ResponseCache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// Len returns the number of cached responses
+func (rc *ResponseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.lru.Len()
+}
+
+// conditional adds the validators of the cached response to req
+// and returns that response, or nil when req is not cached
+func (rc *ResponseCache) conditional(req *http.Request) *cacheEntry {
+	if req.Method != http.MethodGet {
+		return nil
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, ok := rc.entries[req.URL.String()]
+	if !ok {
+		return nil
+	}
+	rc.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+
+	if etag := entry.header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := entry.header.Get("Last-Modified"); modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+	return entry
+}
+
+// update returns the response to decode: the cached one when the server
+// answered 304, otherwise resp, which is stored if it carries validators
+func (rc *ResponseCache) update(req *http.Request, resp *http.Response, cached *cacheEntry) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return resp, nil
+	}
+	key := req.URL.String()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		header := cached.header.Clone()
+		for name, values := range resp.Header {
+			header[name] = values
+		}
+		rc.put(&cacheEntry{key: key, header: header, body: cached.body})
+
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") {
+		rc.remove(key)
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rc.put(&cacheEntry{key: key, header: resp.Header.Clone(), body: body})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+func (rc *ResponseCache) put(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, ok := rc.entries[entry.key]; ok {
+		elem.Value = entry
+		rc.lru.MoveToFront(elem)
+		return
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+
+	if rc.maxEntries > 0 && rc.lru.Len() > rc.maxEntries {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (rc *ResponseCache) remove(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, ok := rc.entries[key]; ok {
+		rc.lru.Remove(elem)
+		delete(rc.entries, key)
+	}
+}
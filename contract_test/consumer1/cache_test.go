@@ -0,0 +1,147 @@
+package consumer1_test
+
+import (
+	"consumer1"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedServer serves products with an ETag derived from their version
+type versionedServer struct {
+	mu          sync.Mutex
+	products    map[int]model.Product
+	notModified int
+	conditional []string
+}
+
+func (s *versionedServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int
+	fmt.Sscanf(req.URL.Path, "/api/v1/products/%d", &id)
+	product, ok := s.products[id]
+	if !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%d-%d"`, product.ID, product.Version)
+	s.conditional = append(s.conditional, req.Header.Get("If-None-Match"))
+	rw.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		s.notModified++
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, _ := json.Marshal(product)
+	rw.Write(body)
+}
+
+func (s *versionedServer) set(product model.Product) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.products[product.ID] = product
+}
+
+func TestClientUnit_CacheRevalidates(t *testing.T) {
+	// Setup mock server
+	backend := &versionedServer{products: map[int]model.Product{
+		1: {ID: 1, ProductName: "Test Product", Version: 1},
+	}}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	// Setup client
+	cache := consumer1.NewResponseCache(0)
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCache(cache))
+	assert.NoError(t, err)
+
+	// Act
+	first, err := client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+	second, err := client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+
+	backend.set(model.Product{ID: 1, ProductName: "Renamed", Version: 2})
+	third, err := client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, first, second)
+	assert.Equal(t, "Renamed", third.ProductName)
+	assert.Equal(t, 1, backend.notModified)
+	assert.Equal(t, []string{"", `"1-1"`, `"1-1"`}, backend.conditional)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestClientUnit_CacheKeepsPageHeaders(t *testing.T) {
+	// Setup mock server answering 304 to every conditional request
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("ETag", `"page"`)
+		if req.Header.Get("If-None-Match") == `"page"` {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("X-Total-Count", "3")
+		rw.Header().Set("X-Next-Cursor", "next")
+		body, _ := json.Marshal([]model.Product{{ID: 1}, {ID: 2}})
+		rw.Write(body)
+	}))
+	defer server.Close()
+
+	// Setup client
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCache(consumer1.NewResponseCache(0)))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.ListProducts(context.Background(), consumer1.ListOptions{Limit: 2})
+	assert.NoError(t, err)
+	page, err := client.ListProducts(context.Background(), consumer1.ListOptions{Limit: 2})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, page.Products, 2)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, "next", page.NextCursor)
+}
+
+func TestClientUnit_CacheEvictsAndForgets(t *testing.T) {
+	// Setup mock server
+	backend := &versionedServer{products: map[int]model.Product{
+		1: {ID: 1, ProductName: "Product 1", Version: 1},
+		2: {ID: 2, ProductName: "Product 2", Version: 1},
+	}}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	// Setup client
+	cache := consumer1.NewResponseCache(1)
+	client, err := consumer1.NewClient(server.URL, consumer1.WithCache(cache))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+	assert.NoError(t, err)
+	_, err = client.GetProduct(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+
+	backend.mu.Lock()
+	delete(backend.products, 2)
+	backend.mu.Unlock()
+	_, err = client.GetProduct(context.Background(), 2)
+
+	// Assert
+	assert.ErrorIs(t, err, consumer1.ErrNotFound)
+	assert.Equal(t, 0, cache.Len())
+}
@@ -2,57 +2,136 @@ package consumer1
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"model"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 var (
 	// ErrNotFound represents a resource not found (404)
-	ErrNotFound = errors.New("not found")
+	ErrNotFound = model.ErrNotFound
 )
 
+// Client calls the product API, create it with NewClient
 type Client struct {
-	BaseURL    *url.URL
-	httpClient *http.Client
+	BaseURL *url.URL
+
+	httpClient    *http.Client
+	userAgent     string
+	authorization string
+	retry         *RetryPolicy
+	breaker       *CircuitBreaker
+	cache         *ResponseCache
+}
+
+// ListOptions filters, sorts and pages the products returned by ListProducts,
+// zero values are left to the server defaults
+type ListOptions struct {
+	Limit    int
+	Cursor   string
+	Sort     string
+	MinPrice *int
+	MaxPrice *int
+	InStock  bool
+	Name     string
 }
 
-// GetUsers gets all users from the API
-func (c *Client) GetProducts() ([]model.Product, error) {
-	req, err := c.newRequest("GET", "/api/v1/products", nil)
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		values.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	if o.MinPrice != nil {
+		values.Set("min_price", strconv.Itoa(*o.MinPrice))
+	}
+	if o.MaxPrice != nil {
+		values.Set("max_price", strconv.Itoa(*o.MaxPrice))
+	}
+	if o.InStock {
+		values.Set("in_stock", "true")
+	}
+	if o.Name != "" {
+		values.Set("name", o.Name)
+	}
+	return values
+}
+
+// ProductPage is one page of products returned by ListProducts
+type ProductPage struct {
+	Products []model.Product
+	// Total is the number of products matching the filters
+	Total int
+	// NextCursor is passed as ListOptions.Cursor to get the next page,
+	// it is empty on the last page
+	NextCursor string
+}
+
+// ListProducts gets one page of products from the API
+func (c *Client) ListProducts(ctx context.Context, opts ListOptions) (*ProductPage, error) {
+	req, err := c.newRequest(ctx, "GET", "/api/v1/products", nil)
 	if err != nil {
 		return nil, err
 	}
-	var products []model.Product
-	_, err = c.do(req, &products)
+	req.URL.RawQuery = opts.values().Encode()
+
+	page := &ProductPage{}
+	res, err := c.do(req, &page.Products)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = res.Header.Get("X-Next-Cursor")
+	if total := res.Header.Get("X-Total-Count"); total != "" {
+		page.Total, _ = strconv.Atoi(total)
+	} else {
+		page.Total = len(page.Products)
+	}
+
+	return page, nil
+}
 
-	return products, err
+// GetProducts gets all products from the API, following every page
+func (c *Client) GetProducts(ctx context.Context) ([]model.Product, error) {
+	var products []model.Product
+	opts := ListOptions{}
+	for {
+		page, err := c.ListProducts(ctx, opts)
+		if err != nil {
+			return products, err
+		}
+		products = append(products, page.Products...)
+		if page.NextCursor == "" {
+			return products, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
 }
 
-// GetUser gets a user by ID from the API
-func (c *Client) GetProduct(id int) (*model.Product, error) {
-	req, err := c.newRequest("GET", fmt.Sprintf("/api/v1/products/%d", id), nil)
+// GetProduct gets a product by ID from the API
+func (c *Client) GetProduct(ctx context.Context, id int) (*model.Product, error) {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/api/v1/products/%d", id), nil)
 	if err != nil {
 		return nil, err
 	}
 	var product model.Product
-	res, err := c.do(req, &product)
-	if err != nil {
-		switch res.StatusCode {
-		case http.StatusNotFound:
-			return nil, ErrNotFound
-		}
+	if _, err := c.do(req, &product); err != nil {
 		return nil, err
 	}
 	return &product, nil
 }
 
-// NewClient creates a new API client with the given base URL and HTTP client.
-func (c *Client) newRequest(method, path string, body interface{}) (*http.Request, error) {
+// newRequest creates an API request, the context cancels it
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
 	rel := &url.URL{Path: path}
 	u := c.BaseURL.ResolveReference(rel)
 	var buf io.ReadWriter
@@ -63,27 +142,54 @@ func (c *Client) newRequest(method, path string, body interface{}) (*http.Reques
 			return nil, err
 		}
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
 	if err != nil {
 		return nil, err
 	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept", "application/json, "+model.ProblemContentType)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
 
 	return req, nil
 }
 
 func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
-	if c.httpClient == nil {
-		c.httpClient = http.DefaultClient
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+	var generation uint64
+	if c.breaker != nil {
+		var err error
+		if generation, err = c.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	var cached *cacheEntry
+	if c.cache != nil {
+		cached = c.cache.conditional(req)
+	}
+	resp, err := c.sendWithRetry(httpClient, req)
+	if c.breaker != nil {
+		c.breaker.record(generation, requestOutcome(req.Context(), resp, err))
+	}
+	if err == nil && c.cache != nil {
+		resp, err = c.cache.update(req, resp, cached)
 	}
-	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp, decodeProblem(resp)
+	}
 	err = json.NewDecoder(resp.Body).Decode(v)
 	return resp, err
 }
@@ -3,6 +3,7 @@
 package consumer1_test
 
 import (
+	"context"
 	"fmt"
 	"model"
 	"net/url"
@@ -55,8 +56,18 @@ func TestClientPact_GetUser(t *testing.T) {
 			UponReceiving("A request to get product").
 			WithRequestPathMatcher("GET", Regex("/api/v1/products/"+strconv.Itoa(id), "/api/v1/products/[0-9]+")).
 			WillRespondWith(200, func(b *consumer.V4ResponseBuilder) {
-				b.BodyMatch(model.Product{}).
-					Header("Content-Type", Term("application/json", `application\/json`))
+				// model.Product holds a time.Time, which BodyMatch cannot reflect over
+				b.JSONBody(Map{
+					"productName": Like("Product A"),
+					"price":       Like(1999),
+					"stock":       Like(50),
+					"id":          Like(id),
+					"version":     Like(1),
+					"createdAt":   Timestamp(),
+					"updatedAt":   Timestamp(),
+				}).
+					Header("Content-Type", Term("application/json", `application\/json`)).
+					Header("ETag", Term(`"5d41402abc4b2a76b9719d911017c592"`, `^"[0-9a-f]+"$`))
 			}).
 			ExecuteTest(t, func(config consumer.MockServerConfig) error {
 				// Act: test our API client behaves correctly
@@ -70,7 +81,7 @@ func TestClientPact_GetUser(t *testing.T) {
 				}
 
 				// Execute the API client
-				product, err := client.GetProduct(id)
+				product, err := client.GetProduct(context.Background(), id)
 
 				// Assert
 				if product.ID != id {
@@ -93,7 +104,8 @@ func TestClientPact_GetUser(t *testing.T) {
 			UponReceiving("A request to get a product that does not exist").
 			WithRequestPathMatcher("GET", Regex("/api/v1/products/"+strconv.Itoa(id), "/api/v1/products/[0-9]+")).
 			WillRespondWith(404, func(b *consumer.V4ResponseBuilder) {
-				b.Header("Content-Type", Term("application/json", `application\/json`))
+				b.BodyMatch(model.Problem{}).
+					Header("Content-Type", Term(model.ProblemContentType, `application\/problem\+json`))
 			}).
 			ExecuteTest(t, func(config consumer.MockServerConfig) error {
 				// Get the Pact mock server URL
@@ -105,10 +117,10 @@ func TestClientPact_GetUser(t *testing.T) {
 				}
 
 				// Act: Execute the API client
-				_, err := client.GetProduct(id)
+				_, err := client.GetProduct(context.Background(), id)
 
 				// Assert
-				assert.Equal(t, model.ErrNotFound, err)
+				assert.ErrorIs(t, err, consumer1.ErrNotFound)
 				return nil
 			})
 		assert.NoError(t, err)
@@ -2,12 +2,14 @@ package consumer1_test
 
 import (
 	"consumer1"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"model"
 
@@ -37,7 +39,7 @@ func TestClientUnit_GetProduct(t *testing.T) {
 	}
 
 	// Act
-	product, err := client.GetProduct(productID)
+	product, err := client.GetProduct(context.Background(), productID)
 	assert.NoError(t, err)
 
 	// Assert
@@ -76,7 +78,7 @@ func TestClientUnit_GetProducts(t *testing.T) {
 	}
 
 	// Act
-	products, err := client.GetProducts()
+	products, err := client.GetProducts(context.Background())
 	assert.NoError(t, err)
 
 	// Assert
@@ -92,3 +94,226 @@ func TestClientUnit_GetProducts(t *testing.T) {
 	assert.Equal(t, products[1].Price, 250)
 	assert.Equal(t, products[1].Stock, 20)
 }
+
+func TestClientUnit_ListProducts(t *testing.T) {
+	// Setup mock server
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/api/v1/products", req.URL.Path)
+		assert.Equal(t, "cursor=abc&in_stock=true&limit=1&min_price=100&name=test&sort=-price", req.URL.RawQuery)
+		products, _ := json.Marshal([]model.Product{
+			{
+				ID:          2,
+				ProductName: "Test Product 2",
+				Price:       250,
+				Stock:       20,
+			},
+		})
+		rw.Header().Set("X-Total-Count", "2")
+		rw.Header().Set("X-Next-Cursor", "def")
+		rw.Write([]byte(products))
+	}))
+	defer server.Close()
+
+	// Setup client
+	u, _ := url.Parse(server.URL)
+	client := &consumer1.Client{
+		BaseURL: u,
+	}
+
+	// Act
+	minPrice := 100
+	page, err := client.ListProducts(context.Background(), consumer1.ListOptions{
+		Limit:    1,
+		Cursor:   "abc",
+		Sort:     "-price",
+		MinPrice: &minPrice,
+		InStock:  true,
+		Name:     "test",
+	})
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Len(t, page.Products, 1)
+	assert.Equal(t, page.Products[0].ID, 2)
+	assert.Equal(t, page.Total, 2)
+	assert.Equal(t, page.NextCursor, "def")
+}
+
+func TestClientUnit_GetProductsFollowsPages(t *testing.T) {
+	// Setup mock server returning one product per page
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		page := []model.Product{{ID: 1, ProductName: "Test Product 1"}}
+		if req.URL.Query().Get("cursor") == "next" {
+			page = []model.Product{{ID: 2, ProductName: "Test Product 2"}}
+		} else {
+			rw.Header().Set("X-Next-Cursor", "next")
+		}
+		products, _ := json.Marshal(page)
+		rw.Write([]byte(products))
+	}))
+	defer server.Close()
+
+	// Setup client
+	u, _ := url.Parse(server.URL)
+	client := &consumer1.Client{
+		BaseURL: u,
+	}
+
+	// Act
+	products, err := client.GetProducts(context.Background())
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Len(t, products, 2)
+	assert.Equal(t, products[0].ID, 1)
+	assert.Equal(t, products[1].ID, 2)
+}
+
+func TestClientUnit_GetProductProblems(t *testing.T) {
+	// Setup mock server answering with problem details
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		problem := model.Problem{
+			Type:     model.ProblemNotFound,
+			Title:    "Product not found",
+			Status:   http.StatusNotFound,
+			Detail:   "product 10: not found",
+			Instance: req.URL.Path,
+		}
+		if req.URL.Path == "/api/v1/products/0" {
+			problem.Type = model.ProblemInvalidID
+			problem.Title = "Invalid product ID"
+			problem.Status = http.StatusBadRequest
+		}
+		rw.Header().Set("Content-Type", model.ProblemContentType)
+		rw.WriteHeader(problem.Status)
+		json.NewEncoder(rw).Encode(problem)
+	}))
+	defer server.Close()
+
+	// Setup client
+	u, _ := url.Parse(server.URL)
+	client := &consumer1.Client{
+		BaseURL: u,
+	}
+
+	// Act
+	_, notFoundErr := client.GetProduct(context.Background(), 10)
+	_, invalidErr := client.GetProduct(context.Background(), 0)
+
+	// Assert
+	assert.ErrorIs(t, notFoundErr, consumer1.ErrNotFound)
+	assert.NotErrorIs(t, notFoundErr, consumer1.ErrInvalidID)
+	var problem *consumer1.ProblemError
+	assert.ErrorAs(t, notFoundErr, &problem)
+	assert.Equal(t, "/api/v1/products/10", problem.Instance)
+	assert.Equal(t, "product 10: not found", problem.Detail)
+
+	assert.ErrorIs(t, invalidErr, consumer1.ErrInvalidID)
+	assert.NotErrorIs(t, invalidErr, consumer1.ErrNotFound)
+}
+
+func TestClientUnit_GetProductNotFoundWithoutProblem(t *testing.T) {
+	// Setup mock server answering with a bare 404
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Setup client
+	u, _ := url.Parse(server.URL)
+	client := &consumer1.Client{
+		BaseURL: u,
+	}
+
+	// Act
+	_, err := client.GetProduct(context.Background(), 10)
+
+	// Assert
+	assert.ErrorIs(t, err, consumer1.ErrNotFound)
+}
+
+func TestClientUnit_NewClientOptions(t *testing.T) {
+	// Setup mock server
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "test-agent", req.Header.Get("User-Agent"))
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+		assert.Equal(t, "yes", req.Header.Get("X-Transport"))
+		product, _ := json.Marshal(model.Product{ID: 1, ProductName: "Test Product"})
+		rw.Write([]byte(product))
+	}))
+	defer server.Close()
+
+	// Setup client
+	client, err := consumer1.NewClient(server.URL,
+		consumer1.WithTimeout(time.Second),
+		consumer1.WithUserAgent("test-agent"),
+		consumer1.WithAuthorization("Bearer secret"),
+		consumer1.WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Transport", "yes")
+			return http.DefaultTransport.RoundTrip(req)
+		})),
+	)
+	assert.NoError(t, err)
+
+	// Act
+	product, err := client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, product.ID, 1)
+}
+
+func TestClientUnit_NewClientInvalidURL(t *testing.T) {
+	_, err := consumer1.NewClient("localhost")
+	assert.Error(t, err)
+}
+
+func TestClientUnit_ContextCancellation(t *testing.T) {
+	// Setup mock server that never answers in time
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// Setup client
+	client, err := consumer1.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.GetProduct(ctx, 1)
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientUnit_Timeout(t *testing.T) {
+	// Setup mock server that never answers in time
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// Setup client
+	client, err := consumer1.NewClient(server.URL, consumer1.WithTimeout(50*time.Millisecond))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	var netErr interface{ Timeout() bool }
+	assert.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
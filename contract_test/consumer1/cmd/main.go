@@ -1,26 +1,33 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/url"
+	"time"
 
 	"consumer1"
 )
 
 func main() {
-	u, _ := url.Parse("http://localhost:8080")
-	client := &consumer1.Client{
-		BaseURL: u,
+	client, err := consumer1.NewClient("http://localhost:8080",
+		consumer1.WithTimeout(5*time.Second),
+		consumer1.WithUserAgent("consumer1-cli"),
+	)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	products, err := client.GetProducts()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	products, err := client.GetProducts(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Println("Products:")
 	log.Println(products)
 
-	product, err := client.GetProduct(1)
+	product, err := client.GetProduct(ctx, 1)
 	if err != nil {
 		log.Fatal(err)
 	}
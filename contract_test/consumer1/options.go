@@ -0,0 +1,67 @@
+package consumer1
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout bounds every request of a client created without WithTimeout
+const DefaultTimeout = 10 * time.Second
+
+// defaultHTTPClient is used by clients built as a struct literal
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// Option configures a Client created by NewClient
+type Option func(*Client)
+
+// WithTimeout sets the time limit of each request, including reading the body
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithTransport sets the transport used to send requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithAuthorization sets the Authorization header of every request,
+// e.g. "Bearer <token>"
+func WithAuthorization(value string) Option {
+	return func(c *Client) {
+		c.authorization = value
+	}
+}
+
+// NewClient creates a new API client for the given base URL
+func NewClient(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme and host are required", baseURL)
+	}
+
+	c := &Client{
+		BaseURL:    u,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,77 @@
+package consumer1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"model"
+	"net/http"
+)
+
+var (
+	// ErrInvalidID is returned when the API rejects a product ID (400)
+	ErrInvalidID = model.ErrInvalidID
+
+	// ErrInvalidParameter is returned when the API rejects a query parameter (400)
+	ErrInvalidParameter = errors.New("invalid query parameter")
+
+	// ErrValidation is returned when the API rejects a product (422)
+	ErrValidation = errors.New("validation failed")
+
+	// ErrConflict is returned when a product already exists (409)
+	ErrConflict = model.ErrConflict
+)
+
+// problemErrors maps the API problem types to the sentinel errors
+var problemErrors = map[string]error{
+	model.ProblemNotFound:         ErrNotFound,
+	model.ProblemInvalidID:        ErrInvalidID,
+	model.ProblemInvalidParameter: ErrInvalidParameter,
+	model.ProblemValidation:       ErrValidation,
+	model.ProblemConflict:         ErrConflict,
+}
+
+// statusErrors is used for responses without a known problem type
+var statusErrors = map[int]error{
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusUnprocessableEntity: ErrValidation,
+}
+
+// ProblemError is an RFC 7807 problem returned by the API, use errors.Is
+// with the package errors (ErrNotFound, ErrInvalidID...) to tell them apart
+type ProblemError struct {
+	model.Problem
+}
+
+func (e *ProblemError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s (%d): %s", e.Title, e.Status, e.Detail)
+	}
+	return fmt.Sprintf("%s (%d)", e.Title, e.Status)
+}
+
+// Is reports whether the problem matches one of the package errors
+func (e *ProblemError) Is(target error) bool {
+	if err, ok := problemErrors[e.Type]; ok {
+		return err == target
+	}
+	return statusErrors[e.Status] == target
+}
+
+// decodeProblem reads the problem details of an error response,
+// falling back to the status code when the body is not problem+json
+func decodeProblem(resp *http.Response) *ProblemError {
+	problem := &ProblemError{}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == model.ProblemContentType {
+		json.NewDecoder(resp.Body).Decode(&problem.Problem)
+	}
+	if problem.Status == 0 {
+		problem.Status = resp.StatusCode
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(resp.StatusCode)
+	}
+	return problem
+}
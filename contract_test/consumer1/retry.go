@@ -0,0 +1,184 @@
+package consumer1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how idempotent requests (GET, HEAD, OPTIONS, PUT,
+// DELETE) are retried on connection errors, 429, 502, 503 and 504
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one,
+	// values below 2 disable retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff, 0 means no cap
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each retry
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction (0 to 1)
+	Jitter float64
+	// MaxElapsed bounds the total time spent across attempts, 0 means no bound
+	MaxElapsed time.Duration
+	// OnAttempt is called after every attempt, e.g. for logging or metrics
+	OnAttempt func(Attempt)
+}
+
+// Attempt describes a finished attempt of a request
+type Attempt struct {
+	// Number starts at 1
+	Number int
+	Method string
+	URL    string
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	Err        error
+	// Retry reports whether another attempt follows after Delay
+	Retry bool
+	Delay time.Duration
+}
+
+// DefaultRetryPolicy makes 3 attempts with backoff growing from 100ms
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxElapsed:     10 * time.Second,
+	}
+}
+
+// WithRetry retries idempotent requests following the policy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+var retryableStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// sendWithRetry sends the request, retrying it as allowed by the policy
+func (c *Client) sendWithRetry(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	policy := c.retry
+	if policy == nil || policy.MaxAttempts < 2 || !idempotentMethods[req.Method] {
+		return httpClient.Do(req)
+	}
+
+	start := time.Now()
+	backoff := policy.InitialBackoff
+	for number := 1; ; number++ {
+		attemptReq, err := rewind(req, number)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(attemptReq)
+
+		attempt := Attempt{Number: number, Method: req.Method, URL: req.URL.String(), Err: err}
+		if resp != nil {
+			attempt.StatusCode = resp.StatusCode
+		}
+		if number < policy.MaxAttempts && retryable(req.Context(), resp, err) {
+			attempt.Delay = policy.jittered(backoff)
+			if after, ok := retryAfter(resp); ok && after > attempt.Delay {
+				attempt.Delay = after
+			}
+			attempt.Retry = policy.MaxElapsed <= 0 || time.Since(start)+attempt.Delay < policy.MaxElapsed
+		}
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(attempt)
+		}
+		if !attempt.Retry {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(attempt.Delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		backoff = time.Duration(float64(backoff) * policy.Multiplier)
+		if policy.MaxBackoff > 0 {
+			backoff = min(backoff, policy.MaxBackoff)
+		}
+	}
+}
+
+// rewind returns the request to send for the given attempt,
+// retries get a fresh copy of the body
+func rewind(req *http.Request, number int) (*http.Request, error) {
+	if number == 1 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be replayed for a retry")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, nil
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Cancellation and deadlines of the caller are final
+		return ctx.Err() == nil
+	}
+	return retryableStatuses[resp.StatusCode]
+}
+
+func (p *RetryPolicy) jittered(backoff time.Duration) time.Duration {
+	if p.Jitter <= 0 || backoff <= 0 {
+		return backoff
+	}
+	delta := p.Jitter * float64(backoff)
+	return time.Duration(float64(backoff) - delta + rand.Float64()*2*delta)
+}
+
+// retryAfter parses the Retry-After header given in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
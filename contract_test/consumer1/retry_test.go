@@ -0,0 +1,181 @@
+package consumer1_test
+
+import (
+	"consumer1"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fastRetry(attempts *[]consumer1.Attempt) consumer1.RetryPolicy {
+	policy := consumer1.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	policy.OnAttempt = func(a consumer1.Attempt) {
+		*attempts = append(*attempts, a)
+	}
+	return policy
+}
+
+func TestClientUnit_RetryOnUnavailable(t *testing.T) {
+	// Setup mock server failing twice before answering
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		product, _ := json.Marshal(model.Product{ID: 1, ProductName: "Test Product"})
+		rw.Write([]byte(product))
+	}))
+	defer server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(fastRetry(&attempts)))
+	assert.NoError(t, err)
+
+	// Act
+	product, err := client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, product.ID, 1)
+	assert.Len(t, attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	assert.True(t, attempts[0].Retry)
+	assert.Equal(t, http.StatusOK, attempts[2].StatusCode)
+	assert.False(t, attempts[2].Retry)
+}
+
+func TestClientUnit_RetryGivesUp(t *testing.T) {
+	// Setup mock server that is always overloaded
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(fastRetry(&attempts)))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	var problem *consumer1.ProblemError
+	assert.ErrorAs(t, err, &problem)
+	assert.Equal(t, http.StatusBadGateway, problem.Status)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestClientUnit_NoRetryOnServerError(t *testing.T) {
+	// Setup mock server failing with a non retryable status
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(fastRetry(&attempts)))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClientUnit_RetryOnConnectionError(t *testing.T) {
+	// Setup a server that is already gone
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(fastRetry(&attempts)))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Len(t, attempts, 3)
+	for _, attempt := range attempts {
+		assert.Error(t, attempt.Err)
+		assert.Equal(t, 0, attempt.StatusCode)
+	}
+}
+
+func TestClientUnit_RetryAfterBeyondDeadline(t *testing.T) {
+	// Setup mock server asking to come back later
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.Header().Set("Retry-After", "120")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	policy := fastRetry(&attempts)
+	policy.MaxElapsed = time.Second
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(policy))
+	assert.NoError(t, err)
+
+	// Act
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, 120*time.Second, attempts[0].Delay)
+	assert.False(t, attempts[0].Retry)
+}
+
+func TestClientUnit_RetryAfterRespected(t *testing.T) {
+	// Setup mock server throttling the first request
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) == 1 {
+			rw.Header().Set("Retry-After", "1")
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		product, _ := json.Marshal(model.Product{ID: 1, ProductName: "Test Product"})
+		rw.Write([]byte(product))
+	}))
+	defer server.Close()
+
+	// Setup client
+	var attempts []consumer1.Attempt
+	client, err := consumer1.NewClient(server.URL, consumer1.WithRetry(fastRetry(&attempts)))
+	assert.NoError(t, err)
+
+	// Act
+	start := time.Now()
+	_, err = client.GetProduct(context.Background(), 1)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, time.Second, attempts[0].Delay)
+}
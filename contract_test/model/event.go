@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+)
+
+// ProductsTopic is the topic product events are published to
+const ProductsTopic = "products"
+
+// Product event types, also sent as the event_type message metadata
+const (
+	EventProductCreated = "ProductCreated"
+	EventProductUpdated = "ProductUpdated"
+	EventProductDeleted = "ProductDeleted"
+	EventStockChanged   = "StockChanged"
+)
+
+// Reasons of a StockChanged event
+const (
+	StockReasonUpdate      = "update"
+	StockReasonReservation = "reservation"
+	StockReasonRelease     = "release"
+	StockReasonExpiry      = "expiry"
+)
+
+// ProductEvent is published when a product is created, changes or is
+// deleted. Product is the state after the change, or the last state of a
+// deleted product, use its Version to discard events arriving out of order.
+type ProductEvent struct {
+	Type    string  `json:"type"`
+	Product Product `json:"product"`
+	// Previous is the state before a ProductUpdated event
+	Previous *Product `json:"previous,omitempty"`
+	// StockDelta and Reason describe a StockChanged event
+	StockDelta int       `json:"stockDelta,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"errors"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Problem types returned by the product API
+const (
+	ProblemNotFound          = "/problems/not-found"
+	ProblemInvalidID         = "/problems/invalid-id"
+	ProblemInvalidParameter  = "/problems/invalid-parameter"
+	ProblemMalformedBody     = "/problems/malformed-body"
+	ProblemValidation        = "/problems/validation"
+	ProblemConflict          = "/problems/conflict"
+	ProblemVersionMismatch   = "/problems/version-mismatch"
+	ProblemVersionRequired   = "/problems/version-required"
+	ProblemInsufficientStock = "/problems/insufficient-stock"
+	ProblemReservationClosed = "/problems/reservation-closed"
+	ProblemInternal          = "/problems/internal"
+)
+
+// ErrInvalidID is returned when a product ID is not a number (400)
+var ErrInvalidID = errors.New("invalid id")
+
+// Problem represents an RFC 7807 problem details response
+type Problem struct {
+	Type     string `json:"type" pact:"example=/problems/not-found"`
+	Title    string `json:"title" pact:"example=Product not found"`
+	Status   int    `json:"status" pact:"example=404"`
+	Detail   string `json:"detail,omitempty" pact:"example=product 10 does not exist"`
+	Instance string `json:"instance,omitempty" pact:"example=/api/v1/products/10"`
+}
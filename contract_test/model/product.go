@@ -2,6 +2,8 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
 // User represents a product in the system
@@ -10,6 +12,55 @@ type Product struct {
 	Price       int    `json:"price" pact:"example=1999"`
 	Stock       int    `json:"stock" pact:"example=50"`
 	ID          int    `json:"id" pact:"example=10"`
+
+	// Version starts at 1 and is incremented by the store on every change,
+	// updates carrying a version are rejected when it is no longer current
+	Version int `json:"version" pact:"example=1"`
+	// CreatedAt is set by the store when the product is created
+	CreatedAt time.Time `json:"createdAt"`
+	// UpdatedAt is set by the store on every change
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Validate checks that the product can be stored
+func (p Product) Validate() error {
+	if p.ProductName == "" {
+		return fmt.Errorf("productName: %w", ErrEmpty)
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("price must not be negative: %w", ErrInvalid)
+	}
+	if p.Stock < 0 {
+		return fmt.Errorf("stock must not be negative: %w", ErrInvalid)
+	}
+	if p.ID < 0 {
+		return fmt.Errorf("id must not be negative: %w", ErrInvalid)
+	}
+	return nil
+}
+
+// ProductPatch represents a partial update of a product,
+// nil fields are left untouched
+type ProductPatch struct {
+	ProductName *string `json:"productName,omitempty"`
+	Price       *int    `json:"price,omitempty"`
+	Stock       *int    `json:"stock,omitempty"`
+
+	// Version is the version the patch applies to, nil skips the check
+	Version *int `json:"version,omitempty"`
+}
+
+// Apply copies the non-nil fields of the patch onto the product
+func (pp ProductPatch) Apply(p *Product) {
+	if pp.ProductName != nil {
+		p.ProductName = *pp.ProductName
+	}
+	if pp.Price != nil {
+		p.Price = *pp.Price
+	}
+	if pp.Stock != nil {
+		p.Stock = *pp.Stock
+	}
 }
 
 var (
@@ -18,6 +69,16 @@ var (
 
 	// ErrEmpty is returned when input string is empty
 	ErrEmpty = errors.New("empty string")
+
+	// ErrInvalid is returned when an input value is out of range (422)
+	ErrInvalid = errors.New("invalid value")
+
+	// ErrConflict represents a resource that already exists (409)
+	ErrConflict = errors.New("already exists")
+
+	// ErrVersionMismatch is returned when a product changed since the
+	// version an update was based on (412)
+	ErrVersionMismatch = errors.New("version mismatch")
 )
 
 // ProductResponse represents the response structure for a product
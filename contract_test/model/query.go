@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultLimit is the page size used when none is requested
+	DefaultLimit = 50
+
+	// MaxLimit is the largest page size that can be requested
+	MaxLimit = 100
+)
+
+// ProductSorts lists the accepted values of ProductQuery.Sort,
+// a leading "-" sorts in descending order
+var ProductSorts = []string{"id", "-id", "name", "-name", "price", "-price"}
+
+// ProductQuery filters, orders and pages a list of products
+type ProductQuery struct {
+	Offset   int
+	Limit    int
+	Sort     string
+	MinPrice *int
+	MaxPrice *int
+	InStock  bool
+	Name     string
+}
+
+// Validate checks the query values are in range
+func (q ProductQuery) Validate() error {
+	if q.Offset < 0 {
+		return fmt.Errorf("offset must not be negative: %w", ErrInvalid)
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d: %w", MaxLimit, ErrInvalid)
+	}
+	if q.Sort != "" && !validSort(q.Sort) {
+		return fmt.Errorf("sort must be one of %v: %w", ProductSorts, ErrInvalid)
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return fmt.Errorf("min_price must not exceed max_price: %w", ErrInvalid)
+	}
+	return nil
+}
+
+func validSort(sort string) bool {
+	for _, s := range ProductSorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultReservationTTL is how long a reservation holds stock when no TTL is requested
+	DefaultReservationTTL = 15 * time.Minute
+
+	// MaxReservationTTL is the longest TTL that can be requested
+	MaxReservationTTL = 24 * time.Hour
+)
+
+// ReservationStatus is the state of a stock reservation
+type ReservationStatus string
+
+const (
+	// ReservationPending holds stock until it is committed, released or expires
+	ReservationPending ReservationStatus = "pending"
+	// ReservationCommitted consumed its stock for good
+	ReservationCommitted ReservationStatus = "committed"
+	// ReservationReleased gave its stock back
+	ReservationReleased ReservationStatus = "released"
+	// ReservationExpired gave its stock back when its TTL ran out
+	ReservationExpired ReservationStatus = "expired"
+)
+
+// Reservation holds part of the stock of a product, the stock is taken
+// when the reservation is made and given back if it is not committed
+type Reservation struct {
+	ID        int               `json:"id"`
+	ProductID int               `json:"productId"`
+	Quantity  int               `json:"quantity"`
+	Status    ReservationStatus `json:"status"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// ReservationRequest is the body of a new reservation
+type ReservationRequest struct {
+	Quantity int `json:"quantity"`
+	// TTLSeconds defaults to DefaultReservationTTL when zero
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+}
+
+// Validate checks the quantity and TTL are in range
+func (r ReservationRequest) Validate() error {
+	if r.Quantity < 1 {
+		return fmt.Errorf("quantity must be at least 1: %w", ErrInvalid)
+	}
+	if r.TTLSeconds < 0 || r.TTLSeconds > int(MaxReservationTTL/time.Second) {
+		return fmt.Errorf("ttlSeconds must be between 0 and %d: %w", int(MaxReservationTTL.Seconds()), ErrInvalid)
+	}
+	return nil
+}
+
+// TTL returns the requested TTL or the default one
+func (r ReservationRequest) TTL() time.Duration {
+	if r.TTLSeconds == 0 {
+		return DefaultReservationTTL
+	}
+	return time.Duration(r.TTLSeconds) * time.Second
+}
+
+var (
+	// ErrReservationNotFound represents a reservation not found (404)
+	ErrReservationNotFound = fmt.Errorf("reservation %w", ErrNotFound)
+
+	// ErrInsufficientStock is returned when a product has less stock than requested (409)
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrReservationClosed is returned when committing or releasing a
+	// reservation that is no longer pending (409)
+	ErrReservationClosed = errors.New("reservation is not pending")
+)
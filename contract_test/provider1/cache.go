@@ -0,0 +1,113 @@
+package provider1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"model"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// productETag returns a strong entity tag derived from the ID, version and
+// update time of the product, the time tells a recreated product apart
+func productETag(product model.Product) string {
+	h := sha256.New()
+	hashProducts(h, product)
+	return entityTag(h)
+}
+
+// pageETag returns a strong entity tag for a page of products, it also
+// changes with the number of matching products
+func pageETag(products []model.Product, total int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "total:%d;", total)
+	hashProducts(h, products...)
+	return entityTag(h)
+}
+
+func hashProducts(h hash.Hash, products ...model.Product) {
+	for _, product := range products {
+		fmt.Fprintf(h, "%d:%d:%d;", product.ID, product.Version, product.UpdatedAt.UnixNano())
+	}
+}
+
+func entityTag(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified evaluates the conditional headers of a GET request,
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2)
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag, true)
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !modified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists
+// the entity tag, weak tags only match with the weak comparison
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setValidators sets the ETag and Last-Modified response headers
+func setValidators(w http.ResponseWriter, etag string, modified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeCacheable writes v as JSON with its validators,
+// or 304 Not Modified when the client copy is still fresh
+func writeCacheable(w http.ResponseWriter, r *http.Request, etag string, modified time.Time, v interface{}) {
+	setValidators(w, etag, modified)
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// expectedVersion returns the product version an update is based on, read
+// from If-Match or else from the version in the body, one of them is required.
+// The store compares it again when writing, so a concurrent change still fails.
+func (h *ProductHandler) expectedVersion(r *http.Request, id, bodyVersion int) (int, error) {
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		if bodyVersion == 0 {
+			return 0, errVersionRequired
+		}
+		return bodyVersion, nil
+	}
+
+	current, err := h.store.ByID(id)
+	if err != nil {
+		return 0, fmt.Errorf("product %d: %w", id, err)
+	}
+	if !etagMatches(match, productETag(*current), false) {
+		return 0, fmt.Errorf("product %d does not match If-Match %s: %w", id, match, model.ErrVersionMismatch)
+	}
+	if bodyVersion != 0 && bodyVersion != current.Version {
+		return 0, fmt.Errorf("product %d is at version %d, not %d: %w", id, current.Version, bodyVersion, model.ErrVersionMismatch)
+	}
+	return current.Version, nil
+}
@@ -1,14 +1,29 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-amqp/v2/pkg/amqp"
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 
+	"model"
 	"provider1"
 	_ "provider1/docs" // This line is needed for swagger to find the generated docs
+	"provider1/repository"
 )
 
 // @title Product Service API
@@ -26,17 +41,98 @@ import (
 // @host localhost:8080
 // @BasePath /api/v1
 func main() {
+	dbPath := flag.String("db", "products.db", "path to the SQLite database file")
+	sweepInterval := flag.Duration("sweep-interval", 30*time.Second, "how often expired stock reservations are released")
+	amqpURL := flag.String("amqp-url", os.Getenv("RABBITMQ_URL"), "RabbitMQ URL product events are published to, no events are published when empty")
+	flag.Parse()
+
+	tp, err := initTracer()
+	if err != nil {
+		log.Fatal("Failed to initialize tracer: ", err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	store, err := repository.OpenSQLite(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to open database: ", err)
+	}
+	defer store.Close()
+	log.Println("Database ready:", *dbPath)
+
+	if err := seedProducts(store); err != nil {
+		log.Fatal("Failed to seed products: ", err)
+	}
+
+	var opts []provider1.HandlerOption
+	if *amqpURL != "" {
+		publisher, err := amqp.NewPublisher(amqp.NewDurableQueueConfig(*amqpURL), watermill.NewStdLogger(false, false))
+		if err != nil {
+			log.Fatal("Failed to create event publisher: ", err)
+		}
+		defer publisher.Close()
+		opts = append(opts, provider1.WithEvents(provider1.NewEventPublisher(publisher)))
+		log.Println("Publishing product events to topic:", model.ProductsTopic)
+	}
+
+	handler := provider1.NewProductHandler(store, opts...)
+	go handler.SweepReservations(context.Background(), *sweepInterval)
+
 	r := mux.NewRouter()
 
 	// API routes
 	api := r.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/products", provider1.GetProducts).Methods("GET")
-	api.HandleFunc("/products/{id}", provider1.GetProduct).Methods("GET")
+	api.HandleFunc("/products", handler.GetProducts).Methods("GET")
+	api.HandleFunc("/products", handler.CreateProduct).Methods("POST")
+	api.HandleFunc("/products/{id}", handler.GetProduct).Methods("GET")
+	api.HandleFunc("/products/{id}", handler.UpdateProduct).Methods("PUT")
+	api.HandleFunc("/products/{id}", handler.PatchProduct).Methods("PATCH")
+	api.HandleFunc("/products/{id}", handler.DeleteProduct).Methods("DELETE")
+	api.HandleFunc("/products/{id}/reservations", handler.CreateReservation).Methods("POST")
+	api.HandleFunc("/products/{id}/reservations/{reservationID}", handler.GetReservation).Methods("GET")
+	api.HandleFunc("/products/{id}/reservations/{reservationID}/commit", handler.CommitReservation).Methods("POST")
+	api.HandleFunc("/products/{id}/reservations/{reservationID}/release", handler.ReleaseReservation).Methods("POST")
 
 	// Swagger
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 	log.Println("Server starting on :8080")
 	log.Println("Swagger UI available at: http://localhost:8080/swagger/index.html")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	log.Fatal(http.ListenAndServe(":8080", otelhttp.NewHandler(r, "product-service")))
+}
+
+// initTracer continues the trace of incoming requests into the published
+// events, spans are exported when OTEL_EXPORTER_OTLP_ENDPOINT is set
+func initTracer() (*sdktrace.TracerProvider, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("product-service"),
+		)),
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		exp, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp, nil
+}
+
+// seedProducts loads the default catalogue into an empty store
+func seedProducts(store provider1.ProductStore) error {
+	products, err := store.GetProducts()
+	if err != nil || len(products) > 0 {
+		return err
+	}
+	for _, product := range provider1.DefaultProducts() {
+		if _, err := store.Create(product); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,133 @@
+package provider1
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"model"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventPublisher publishes product events to model.ProductsTopic
+type EventPublisher struct {
+	publisher message.Publisher
+	tracer    trace.Tracer
+}
+
+// NewEventPublisher creates an EventPublisher sending through a Watermill publisher
+func NewEventPublisher(publisher message.Publisher) *EventPublisher {
+	return &EventPublisher{
+		publisher: publisher,
+		tracer:    otel.Tracer("product-service"),
+	}
+}
+
+// Publish sends the event with the W3C trace context of ctx in the message metadata
+func (p *EventPublisher) Publish(ctx context.Context, event model.ProductEvent) error {
+	ctx, span := p.tracer.Start(ctx, "publish_product_event")
+	defer span.End()
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		return err
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), data)
+	msg.Metadata.Set("event_type", event.Type)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(msg.Metadata))
+
+	span.SetAttributes(
+		attribute.String("message.id", msg.UUID),
+		attribute.String("topic", model.ProductsTopic),
+		attribute.String("event.type", event.Type),
+		attribute.Int("product.id", event.Product.ID),
+	)
+
+	if err := p.publisher.Publish(model.ProductsTopic, msg); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// HandlerOption configures a ProductHandler created by NewProductHandler
+type HandlerOption func(*ProductHandler)
+
+// WithEvents publishes a product event after every successful change
+func WithEvents(events *EventPublisher) HandlerOption {
+	return func(h *ProductHandler) {
+		h.events = events
+	}
+}
+
+// publish sends an event when events are enabled, the change is already
+// stored so a failure is only logged
+func (h *ProductHandler) publish(ctx context.Context, event model.ProductEvent) {
+	if h.events == nil {
+		return
+	}
+	if err := h.events.Publish(ctx, event); err != nil {
+		log.Printf("Failed to publish %s event for product %d: %v", event.Type, event.Product.ID, err)
+	}
+}
+
+// snapshot reads the product before a change when events are enabled
+func (h *ProductHandler) snapshot(id int) *model.Product {
+	if h.events == nil {
+		return nil
+	}
+	product, err := h.store.ByID(id)
+	if err != nil {
+		return nil
+	}
+	return product
+}
+
+// publishChange publishes the events describing an update from previous
+// to product, the version check of the update makes previous exact. A nil
+// product means previous was deleted.
+func (h *ProductHandler) publishChange(ctx context.Context, previous, product *model.Product) {
+	if previous == nil {
+		return
+	}
+	if product == nil {
+		h.publish(ctx, model.ProductEvent{Type: model.EventProductDeleted, Product: *previous})
+		return
+	}
+	if previous.ProductName != product.ProductName || previous.Price != product.Price {
+		h.publish(ctx, model.ProductEvent{Type: model.EventProductUpdated, Product: *product, Previous: previous})
+	}
+	if previous.Stock != product.Stock {
+		h.publishStock(ctx, *product, product.Stock-previous.Stock, model.StockReasonUpdate)
+	}
+}
+
+// publishStock publishes a StockChanged event
+func (h *ProductHandler) publishStock(ctx context.Context, product model.Product, delta int, reason string) {
+	h.publish(ctx, model.ProductEvent{Type: model.EventStockChanged, Product: product, StockDelta: delta, Reason: reason})
+}
+
+// publishReservationStock publishes the stock change caused by a
+// reservation, with the product as read right after it
+func (h *ProductHandler) publishReservationStock(ctx context.Context, reservation model.Reservation, delta int, reason string) {
+	if h.events == nil {
+		return
+	}
+	product, err := h.store.ByID(reservation.ProductID)
+	if err != nil {
+		log.Printf("Failed to read product %d for its %s event: %v", reservation.ProductID, model.EventStockChanged, err)
+		return
+	}
+	h.publishStock(ctx, *product, delta, reason)
+}
@@ -0,0 +1,115 @@
+package provider1_test
+
+import (
+	"context"
+	"encoding/json"
+	"model"
+	"net/http"
+	"net/http/httptest"
+	"provider1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// receiveEvent waits for the next product event
+func receiveEvent(t *testing.T, messages <-chan *message.Message) (model.ProductEvent, *message.Message) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		msg.Ack()
+		var event model.ProductEvent
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		return event, msg
+	case <-time.After(time.Second):
+		t.Fatal("no product event published")
+		return model.ProductEvent{}, nil
+	}
+}
+
+func TestProductEvents(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		pubSub := gochannel.NewGoChannel(gochannel.Config{OutputChannelBuffer: 16}, watermill.NopLogger{})
+		defer pubSub.Close()
+		messages, err := pubSub.Subscribe(context.Background(), model.ProductsTopic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := newStore(t)
+		server := provider1.GetHTTPHandler(provider1.NewProductHandler(store,
+			provider1.WithEvents(provider1.NewEventPublisher(pubSub))))
+
+		// The request belongs to a trace, its events must carry it on
+		traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+		}))
+		req := httptest.NewRequest("POST", "/api/v1/products", strings.NewReader(`{"productName":"Product 1","price":100,"stock":10}`)).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		event, msg := receiveEvent(t, messages)
+		assert.Equal(t, model.EventProductCreated, event.Type)
+		assert.Equal(t, model.EventProductCreated, msg.Metadata.Get("event_type"))
+		assert.Contains(t, msg.Metadata.Get("traceparent"), traceID.String())
+		assert.Equal(t, 1, event.Product.ID)
+		assert.False(t, event.OccurredAt.IsZero())
+
+		// Repricing and restocking at once publishes both events
+		rr = serve(server, "PATCH", "/api/v1/products/1", `{"price":120,"stock":8,"version":1}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// gochannel does not keep the order of messages published together
+		events := map[string]model.ProductEvent{}
+		for i := 0; i < 2; i++ {
+			event, _ = receiveEvent(t, messages)
+			events[event.Type] = event
+		}
+		if assert.Contains(t, events, model.EventProductUpdated) {
+			assert.Equal(t, 100, events[model.EventProductUpdated].Previous.Price)
+			assert.Equal(t, 120, events[model.EventProductUpdated].Product.Price)
+		}
+		if assert.Contains(t, events, model.EventStockChanged) {
+			assert.Equal(t, -2, events[model.EventStockChanged].StockDelta)
+			assert.Equal(t, model.StockReasonUpdate, events[model.EventStockChanged].Reason)
+		}
+
+		rr = serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":3}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		event, _ = receiveEvent(t, messages)
+		assert.Equal(t, model.EventStockChanged, event.Type)
+		assert.Equal(t, -3, event.StockDelta)
+		assert.Equal(t, 5, event.Product.Stock)
+		assert.Equal(t, model.StockReasonReservation, event.Reason)
+
+		rr = serve(server, "POST", "/api/v1/products/1/reservations/1/release", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		event, _ = receiveEvent(t, messages)
+		assert.Equal(t, 3, event.StockDelta)
+		assert.Equal(t, 8, event.Product.Stock)
+		assert.Equal(t, model.StockReasonRelease, event.Reason)
+
+		rr = serve(server, "DELETE", "/api/v1/products/1", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		event, msg = receiveEvent(t, messages)
+		assert.Equal(t, model.EventProductDeleted, event.Type)
+		assert.Equal(t, model.EventProductDeleted, msg.Metadata.Get("event_type"))
+		assert.Equal(t, 1, event.Product.ID)
+		assert.Equal(t, 8, event.Product.Stock)
+	})
+}
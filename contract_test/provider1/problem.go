@@ -0,0 +1,60 @@
+package provider1
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"model"
+	"net/http"
+)
+
+var (
+	errMalformedBody    = errors.New("malformed request body")
+	errInvalidParameter = errors.New("invalid query parameter")
+	errVersionRequired  = errors.New("If-Match header or version field required")
+)
+
+// problemFor maps an error to the RFC 7807 problem describing it
+func problemFor(err error) model.Problem {
+	switch {
+	case errors.Is(err, model.ErrInvalidID):
+		return model.Problem{Type: model.ProblemInvalidID, Title: "Invalid product ID", Status: http.StatusBadRequest}
+	case errors.Is(err, errInvalidParameter):
+		return model.Problem{Type: model.ProblemInvalidParameter, Title: "Invalid query parameter", Status: http.StatusBadRequest}
+	case errors.Is(err, errMalformedBody):
+		return model.Problem{Type: model.ProblemMalformedBody, Title: "Malformed request body", Status: http.StatusBadRequest}
+	case errors.Is(err, model.ErrReservationNotFound):
+		return model.Problem{Type: model.ProblemNotFound, Title: "Reservation not found", Status: http.StatusNotFound}
+	case errors.Is(err, model.ErrNotFound):
+		return model.Problem{Type: model.ProblemNotFound, Title: "Product not found", Status: http.StatusNotFound}
+	case errors.Is(err, model.ErrConflict):
+		return model.Problem{Type: model.ProblemConflict, Title: "Product already exists", Status: http.StatusConflict}
+	case errors.Is(err, model.ErrInsufficientStock):
+		return model.Problem{Type: model.ProblemInsufficientStock, Title: "Insufficient stock", Status: http.StatusConflict}
+	case errors.Is(err, model.ErrReservationClosed):
+		return model.Problem{Type: model.ProblemReservationClosed, Title: "Reservation is not pending", Status: http.StatusConflict}
+	case errors.Is(err, model.ErrVersionMismatch):
+		return model.Problem{Type: model.ProblemVersionMismatch, Title: "Product was modified", Status: http.StatusPreconditionFailed}
+	case errors.Is(err, errVersionRequired):
+		return model.Problem{Type: model.ProblemVersionRequired, Title: "Product version required", Status: http.StatusPreconditionRequired}
+	case errors.Is(err, model.ErrEmpty), errors.Is(err, model.ErrInvalid):
+		return model.Problem{Type: model.ProblemValidation, Title: "Validation failed", Status: http.StatusUnprocessableEntity}
+	default:
+		return model.Problem{Type: model.ProblemInternal, Title: "Internal server error", Status: http.StatusInternalServerError}
+	}
+}
+
+// writeProblem writes err as an application/problem+json response
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemFor(err)
+	if problem.Status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	} else {
+		problem.Detail = err.Error()
+	}
+	problem.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", model.ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -5,50 +5,123 @@ import (
 	"fmt"
 	"model"
 	"net/http"
-	"provider1/repository"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func GetHTTPHandler() *http.ServeMux {
+// ProductStore is the storage used by the product handlers
+type ProductStore interface {
+	GetProducts() ([]model.Product, error)
+	FindProducts(query model.ProductQuery) ([]model.Product, int, error)
+	ByID(ID int) (*model.Product, error)
+	Create(product model.Product) (*model.Product, error)
+	Update(product model.Product) (*model.Product, error)
+	Patch(ID int, patch model.ProductPatch) (*model.Product, error)
+	Delete(ID int) error
+
+	Reserve(productID, quantity int, ttl time.Duration) (*model.Reservation, error)
+	Reservation(productID, ID int) (*model.Reservation, error)
+	CommitReservation(productID, ID int) (*model.Reservation, error)
+	ReleaseReservation(productID, ID int) (*model.Reservation, error)
+	ExpireReservations(now time.Time) ([]model.Reservation, error)
+}
+
+// ProductHandler serves the product API on top of a ProductStore
+type ProductHandler struct {
+	store  ProductStore
+	events *EventPublisher
+}
+
+// NewProductHandler creates a ProductHandler backed by the given store
+func NewProductHandler(store ProductStore, opts ...HandlerOption) *ProductHandler {
+	h := &ProductHandler{store: store}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func GetHTTPHandler(h *ProductHandler) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/products/{id}", GetProduct)
-	mux.HandleFunc("/api/v1/products/", GetProducts)
+	mux.HandleFunc("GET /api/v1/products/{id}", h.GetProduct)
+	mux.HandleFunc("PUT /api/v1/products/{id}", h.UpdateProduct)
+	mux.HandleFunc("PATCH /api/v1/products/{id}", h.PatchProduct)
+	mux.HandleFunc("DELETE /api/v1/products/{id}", h.DeleteProduct)
+	mux.HandleFunc("POST /api/v1/products/{id}/reservations", h.CreateReservation)
+	mux.HandleFunc("GET /api/v1/products/{id}/reservations/{reservationID}", h.GetReservation)
+	mux.HandleFunc("POST /api/v1/products/{id}/reservations/{reservationID}/commit", h.CommitReservation)
+	mux.HandleFunc("POST /api/v1/products/{id}/reservations/{reservationID}/release", h.ReleaseReservation)
+	for _, path := range []string{"/api/v1/products", "/api/v1/products/{$}"} {
+		mux.HandleFunc("GET "+path, h.GetProducts)
+		mux.HandleFunc("POST "+path, h.CreateProduct)
+	}
 
 	return mux
 }
 
-// productRepository is a mock in-memory representation of our product repository
-var GproductRepository = &repository.ProductRepository{
-	Products: map[string]*model.Product{
-		"product1": {
+// DefaultProducts is the catalogue the service starts with
+func DefaultProducts() []model.Product {
+	return []model.Product{
+		{
 			ProductName: "Product 1",
 			Price:       100,
 			Stock:       10,
 			ID:          1,
 		},
-		"product2": {
+		{
 			ProductName: "Product 2",
 			Price:       200,
 			Stock:       20,
 			ID:          2,
 		},
-	},
+	}
 }
 
-// GetProducts handles the HTTP request to retrieve all products
+// GetProducts handles the HTTP request to retrieve a page of products
 // @Summary Get all products
-// @Description Get all products from the system
+// @Description Get a page of products, filtered and sorted. The response headers carry the pagination metadata.
 // @Tags products
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (1-100, default 50)"
+// @Param cursor query string false "Cursor of the page to return, taken from X-Next-Cursor"
+// @Param sort query string false "Sort order" Enums(id, -id, name, -name, price, -price)
+// @Param min_price query int false "Minimum price"
+// @Param max_price query int false "Maximum price"
+// @Param in_stock query bool false "Only products with stock left"
+// @Param name query string false "Case-insensitive substring of the product name"
+// @Param If-None-Match header string false "ETag of the cached page"
 // @Success 200 {array} model.Product
+// @Success 304
+// @Header 200 {integer} X-Total-Count "Number of products matching the filters"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {string} Link "URL of the next page with rel=next"
+// @Header 200,304 {string} ETag "Strong validator of the page"
+// @Failure 400 {object} model.Problem
 // @Router /products [get]
-func GetProducts(w http.ResponseWriter, r *http.Request) {
-	products := GproductRepository.GetProducts()
-	w.Header().Set("Content-Type", "application/json")
-	resBody, _ := json.Marshal(products)
-	w.Write(resBody)
+func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
+	query, err := parseProductQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidParameter, err))
+		return
+	}
+
+	products, total, err := h.store.FindProducts(query)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if next := query.Offset + len(products); next < total {
+		cursor := encodeCursor(next)
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, pageURL(r.URL, cursor)))
+	}
+	// A page has no Last-Modified: deleting a product or moving one out of the
+	// filters changes the page without a later update time
+	writeCacheable(w, r, pageETag(products, total), time.Time{}, products)
 }
 
 // GetProduct handles the HTTP request to retrieve a product by its ID
@@ -58,25 +131,219 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Product ID"
+// @Param If-None-Match header string false "ETag of the cached product"
+// @Param If-Modified-Since header string false "Last-Modified of the cached product"
 // @Success 200 {object} model.Product
-// @Failure 404 {object} map[string]string
+// @Success 304
+// @Header 200,304 {string} ETag "Strong validator derived from the product version"
+// @Header 200,304 {string} Last-Modified "Update time of the product"
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
 // @Router /products/{id} [get]
-func GetProduct(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Get product ID from mux vars
-	a := strings.Split(r.URL.Path, "/")
-	id, _ := strconv.Atoi(a[len(a)-1])
+func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
 
 	fmt.Println("Looking for product ID:", id)
 
-	product, err := GproductRepository.ByID(id)
+	product, err := h.store.ByID(id)
+	if err != nil {
+		writeProblem(w, r, fmt.Errorf("product %d: %w", id, err))
+		return
+	}
+
+	writeCacheable(w, r, productETag(*product), product.UpdatedAt, product)
+}
+
+// CreateProduct handles the HTTP request to create a new product
+// @Summary Create a product
+// @Description Create a new product, the ID is assigned when omitted
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param product body model.Product true "Product"
+// @Success 201 {object} model.Product
+// @Failure 400 {object} model.Problem
+// @Failure 409 {object} model.Problem
+// @Failure 422 {object} model.Problem
+// @Router /products [post]
+func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product model.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		writeProblem(w, r, fmt.Errorf("%w: %w", errMalformedBody, err))
+		return
+	}
+
+	created, err := h.store.Create(product)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	h.publish(r.Context(), model.ProductEvent{Type: model.EventProductCreated, Product: *created})
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/products/%d", created.ID))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdateProduct handles the HTTP request to replace a product
+// @Summary Replace a product
+// @Description Replace all fields of an existing product. The product version is required, either as If-Match or in the body.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag of the product being replaced"
+// @Param product body model.Product true "Product"
+// @Success 200 {object} model.Product
+// @Header 200 {string} ETag "Validator of the updated product"
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Failure 412 {object} model.Problem
+// @Failure 422 {object} model.Problem
+// @Failure 428 {object} model.Problem
+// @Router /products/{id} [put]
+func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	var product model.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		writeProblem(w, r, fmt.Errorf("%w: %w", errMalformedBody, err))
+		return
+	}
+	if product.ID != 0 && product.ID != id {
+		writeProblem(w, r, fmt.Errorf("product ID %d does not match the URL: %w", product.ID, model.ErrInvalid))
+		return
+	}
+	product.ID = id
+	if product.Version, err = h.expectedVersion(r, id, product.Version); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	previous := h.snapshot(id)
+	updated, err := h.store.Update(product)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Product not found"})
-	} else {
-		w.WriteHeader(http.StatusOK)
-		resBody, _ := json.Marshal(product)
-		w.Write(resBody)
+		writeProblem(w, r, err)
+		return
 	}
+	h.publishChange(r.Context(), previous, updated)
+
+	setValidators(w, productETag(*updated), updated.UpdatedAt)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// PatchProduct handles the HTTP request to partially update a product
+// @Summary Update a product
+// @Description Update the given fields of an existing product. The product version is required, either as If-Match or in the body.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag of the product being updated"
+// @Param patch body model.ProductPatch true "Fields to update"
+// @Success 200 {object} model.Product
+// @Header 200 {string} ETag "Validator of the updated product"
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Failure 412 {object} model.Problem
+// @Failure 422 {object} model.Problem
+// @Failure 428 {object} model.Problem
+// @Router /products/{id} [patch]
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	var patch model.ProductPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeProblem(w, r, fmt.Errorf("%w: %w", errMalformedBody, err))
+		return
+	}
+	bodyVersion := 0
+	if patch.Version != nil {
+		bodyVersion = *patch.Version
+	}
+	version, err := h.expectedVersion(r, id, bodyVersion)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	patch.Version = &version
+
+	previous := h.snapshot(id)
+	patched, err := h.store.Patch(id, patch)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	h.publishChange(r.Context(), previous, patched)
+
+	setValidators(w, productETag(*patched), patched.UpdatedAt)
+	writeJSON(w, http.StatusOK, patched)
+}
+
+// DeleteProduct handles the HTTP request to delete a product
+// @Summary Delete a product
+// @Description Delete a product by its ID
+// @Tags products
+// @Param id path int true "Product ID"
+// @Success 204
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Router /products/{id} [delete]
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	previous := h.snapshot(id)
+	if err := h.store.Delete(id); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	h.publishChange(r.Context(), previous, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// productID reads the product ID from the URL path
+func productID(r *http.Request) (int, error) {
+	return pathID(r, "products")
+}
+
+// pathID reads the ID following a segment of the URL path, e.g. the
+// reservation ID of /api/v1/products/1/reservations/2/commit. It works
+// with both http.ServeMux and gorilla/mux routes.
+func pathID(r *http.Request, segment string) (int, error) {
+	a := strings.Split(r.URL.Path, "/")
+	value := ""
+	for i := 0; i < len(a)-1; i++ {
+		if a[i] == segment {
+			value = a[i+1]
+			break
+		}
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a %s ID: %w", value, strings.TrimSuffix(segment, "s"), model.ErrInvalidID)
+	}
+	return id, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"provider1"
 	"testing"
 
@@ -24,12 +25,20 @@ var port, _ = utils.GetFreePort()
 func TestPactProvider(t *testing.T) {
 	log.SetLogLevel("INFO")
 
+	// Mirror cmd/server and verify against the SQLite store
+	repo, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	store = repo
+
 	go startInstrumentedProvider()
 
 	verifier := provider.NewVerifier()
 
 	// Verify the Provider - Branch-based Published Pacts for any known consumers
-	err := verifier.VerifyProvider(t, provider.VerifyRequest{
+	err = verifier.VerifyProvider(t, provider.VerifyRequest{
 		Provider:           "provider1",
 		ProviderBaseURL:    fmt.Sprintf("http://127.0.0.1:%d", port),
 		ProviderBranch:     os.Getenv("VERSION_BRANCH"),
@@ -43,8 +52,7 @@ func TestPactProvider(t *testing.T) {
 		ProviderVersion:            os.Getenv("VERSION_COMMIT"),
 		StateHandlers:              stateHandlers,
 		BeforeEach: func() error {
-			provider1.GproductRepository = productExists
-			return nil
+			return setProducts(productExists...)
 		},
 	})
 
@@ -55,19 +63,17 @@ func TestPactProvider(t *testing.T) {
 
 var stateHandlers = models.StateHandlers{
 	"Product exists": func(setup bool, s models.ProviderState) (models.ProviderStateResponse, error) {
-		provider1.GproductRepository = productExists
-		return models.ProviderStateResponse{}, nil
+		return models.ProviderStateResponse{}, setProducts(productExists...)
 	},
 	"Product does not exist": func(setup bool, s models.ProviderState) (models.ProviderStateResponse, error) {
-		provider1.GproductRepository = productDoesNotExist
-		return models.ProviderStateResponse{}, nil
+		return models.ProviderStateResponse{}, setProducts(productDoesNotExist...)
 	},
 }
 
 // Starts the provider API with hooks for provider states.
 // This essentially mirrors the main.go file, with extra routes added.
 func startInstrumentedProvider() {
-	mux := provider1.GetHTTPHandler()
+	mux := provider1.GetHTTPHandler(provider1.NewProductHandler(store))
 
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
@@ -80,18 +86,36 @@ func startInstrumentedProvider() {
 
 }
 
+// store backs the instrumented provider, provider states replace its content
+var store provider1.ProductStore
+
+// setProducts replaces every product in the store with the given ones
+func setProducts(products ...model.Product) error {
+	existing, err := store.GetProducts()
+	if err != nil {
+		return err
+	}
+	for _, product := range existing {
+		if err := store.Delete(product.ID); err != nil {
+			return err
+		}
+	}
+	for _, product := range products {
+		if _, err := store.Create(product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Provider States data sets
-var productExists = &repository.ProductRepository{
-	Products: map[string]*model.Product{
-		"product10": {
-			ID:          10,
-			ProductName: "Product 10",
-			Price:       100,
-			Stock:       10,
-		},
+var productExists = []model.Product{
+	{
+		ID:          10,
+		ProductName: "Product 10",
+		Price:       100,
+		Stock:       10,
 	},
 }
 
-var productDoesNotExist = &repository.ProductRepository{
-	Products: map[string]*model.Product{},
-}
+var productDoesNotExist = []model.Product{}
@@ -2,78 +2,503 @@ package provider1_test
 
 import (
 	"encoding/json"
+	"errors"
 	"model"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"provider1"
+	"provider1/repository"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetProducts(t *testing.T) {
-	req, err := http.NewRequest("GET", "/api/v1/products", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		req, err := http.NewRequest("GET", "/api/v1/products", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(provider1.GetProducts)
-	handler.ServeHTTP(rr, req)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(newDefaultHandler(t, newStore).GetProducts)
+		handler.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, rr.Code)
 
-	var products []*model.Product
-	err = json.Unmarshal(rr.Body.Bytes(), &products)
-	if err != nil {
-		t.Fatal(err)
-	}
+		var products []*model.Product
+		err = json.Unmarshal(rr.Body.Bytes(), &products)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	assert.Len(t, products, 2)
-	assert.Equal(t, "Product 1", products[0].ProductName)
-	assert.Equal(t, 100, products[0].Price)
-	assert.Equal(t, 10, products[0].Stock)
-	assert.Equal(t, 1, products[0].ID)
+		assert.Len(t, products, 2)
+		assert.Equal(t, "Product 1", products[0].ProductName)
+		assert.Equal(t, 100, products[0].Price)
+		assert.Equal(t, 10, products[0].Stock)
+		assert.Equal(t, 1, products[0].ID)
 
-	assert.Equal(t, "Product 2", products[1].ProductName)
-	assert.Equal(t, 200, products[1].Price)
-	assert.Equal(t, 20, products[1].Stock)
-	assert.Equal(t, 2, products[1].ID)
+		assert.Equal(t, "Product 2", products[1].ProductName)
+		assert.Equal(t, 200, products[1].Price)
+		assert.Equal(t, 20, products[1].Stock)
+		assert.Equal(t, 2, products[1].ID)
+	})
 }
 
 func TestGetProductByID(t *testing.T) {
-	req, err := http.NewRequest("GET", "/api/v1/products/1", nil)
-	if err != nil {
-		t.Fatal(err)
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		req, err := http.NewRequest("GET", "/api/v1/products/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(newDefaultHandler(t, newStore).GetProduct)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var product model.Product
+		err = json.Unmarshal(rr.Body.Bytes(), &product)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "Product 1", product.ProductName)
+		assert.Equal(t, 100, product.Price)
+		assert.Equal(t, 10, product.Stock)
+		assert.Equal(t, 1, product.ID)
+	})
+}
+
+func TestGetProductByIDNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		req, err := http.NewRequest("GET", "/api/v1/products/999", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(newDefaultHandler(t, newStore).GetProduct)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// newStoreFunc creates a store holding the given products
+type newStoreFunc func(t *testing.T, products ...model.Product) provider1.ProductStore
+
+// stores lists every ProductStore implementation the handlers are tested against
+var stores = map[string]newStoreFunc{
+	"memory": func(t *testing.T, products ...model.Product) provider1.ProductStore {
+		return repository.NewProductRepository(products...)
+	},
+	"sqlite": func(t *testing.T, products ...model.Product) provider1.ProductStore {
+		repo, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "products.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		for _, product := range products {
+			if _, err := repo.Create(product); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return repo
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, newStore newStoreFunc)) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			test(t, newStore)
+		})
 	}
+}
 
+func newDefaultHandler(t *testing.T, newStore newStoreFunc) *provider1.ProductHandler {
+	return provider1.NewProductHandler(newStore(t, provider1.DefaultProducts()...))
+}
+
+// newServer returns the routed product API backed by a fresh store
+func newServer(t *testing.T, newStore newStoreFunc, products ...model.Product) (http.Handler, provider1.ProductStore) {
+	store := newStore(t, products...)
+	return provider1.GetHTTPHandler(provider1.NewProductHandler(store)), store
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(provider1.GetProduct)
 	handler.ServeHTTP(rr, req)
+	return rr
+}
 
-	assert.Equal(t, http.StatusOK, rr.Code)
+func TestCreateProduct(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
 
-	var product model.Product
-	err = json.Unmarshal(rr.Body.Bytes(), &product)
-	if err != nil {
-		t.Fatal(err)
-	}
+		rr := serve(server, "POST", "/api/v1/products", `{"productName":"Product 2","price":200,"stock":20}`)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "/api/v1/products/2", rr.Header().Get("Location"))
 
-	assert.Equal(t, "Product 1", product.ProductName)
-	assert.Equal(t, 100, product.Price)
-	assert.Equal(t, 10, product.Stock)
-	assert.Equal(t, 1, product.ID)
+		var product model.Product
+		err := json.Unmarshal(rr.Body.Bytes(), &product)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, model.Product{ID: 2, ProductName: "Product 2", Price: 200, Stock: 20, Version: 1, CreatedAt: product.UpdatedAt, UpdatedAt: product.UpdatedAt}, product)
+
+		stored, err := repo.ByID(2)
+		assert.NoError(t, err)
+		assert.Equal(t, "Product 2", stored.ProductName)
+	})
 }
 
-func TestGetProductByIDNotFound(t *testing.T) {
-	req, err := http.NewRequest("GET", "/api/v1/products/999", nil)
-	if err != nil {
-		t.Fatal(err)
+func TestCreateProductConflict(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "POST", "/api/v1/products", `{"id":1,"productName":"Duplicate","price":200,"stock":20}`)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+func TestCreateProductInvalid(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore)
+
+		rr := serve(server, "POST", "/api/v1/products", `{"productName":"","price":200,"stock":20}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		rr = serve(server, "POST", "/api/v1/products", `{"productName":"Product","price":-1,"stock":20}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		rr = serve(server, "POST", "/api/v1/products", `not json`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestUpdateProduct(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "PUT", "/api/v1/products/1", `{"productName":"Renamed","price":150,"stock":5,"version":1}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("ETag"))
+		stored, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Product{ID: 1, ProductName: "Renamed", Price: 150, Stock: 5, Version: 2, CreatedAt: stored.CreatedAt, UpdatedAt: stored.UpdatedAt}, *stored)
+
+		rr = serve(server, "PUT", "/api/v1/products/2", `{"productName":"Missing","price":150,"stock":5,"version":1}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = serve(server, "PUT", "/api/v1/products/1", `{"id":2,"productName":"Renamed","price":150,"stock":5,"version":2}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestPatchProduct(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "PATCH", "/api/v1/products/1", `{"stock":3,"version":1}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		stored, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 3, Version: 2, CreatedAt: stored.CreatedAt, UpdatedAt: stored.UpdatedAt}, *stored)
+
+		rr = serve(server, "PATCH", "/api/v1/products/1", `{"stock":-3,"version":2}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestDeleteProduct(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "DELETE", "/api/v1/products/1", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		_, err := repo.ByID(1)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+
+		rr = serve(server, "DELETE", "/api/v1/products/1", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestGetProductsPagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore,
+			model.Product{ID: 1, ProductName: "Apple", Price: 300, Stock: 0},
+			model.Product{ID: 2, ProductName: "Banana", Price: 100, Stock: 5},
+			model.Product{ID: 3, ProductName: "Cherry", Price: 200, Stock: 5},
+		)
+
+		rr := serve(server, "GET", "/api/v1/products?limit=2&sort=-price", "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "3", rr.Header().Get("X-Total-Count"))
+		cursor := rr.Header().Get("X-Next-Cursor")
+		assert.NotEmpty(t, cursor)
+		assert.Equal(t, `</api/v1/products?cursor=`+cursor+`&limit=2&sort=-price>; rel="next"`, rr.Header().Get("Link"))
+
+		var products []model.Product
+		err := json.Unmarshal(rr.Body.Bytes(), &products)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []int{1, 3}, productIDs(products))
+
+		rr = serve(server, "GET", "/api/v1/products?limit=2&sort=-price&cursor="+cursor, "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("X-Next-Cursor"))
+		err = json.Unmarshal(rr.Body.Bytes(), &products)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []int{2}, productIDs(products))
+	})
+}
+
+func TestGetProductsFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore,
+			model.Product{ID: 1, ProductName: "Green Apple", Price: 300, Stock: 0},
+			model.Product{ID: 2, ProductName: "Banana", Price: 100, Stock: 5},
+			model.Product{ID: 3, ProductName: "Red apple", Price: 200, Stock: 5},
+			model.Product{ID: 4, ProductName: "Pineapple", Price: 50, Stock: 5},
+		)
+
+		tests := map[string][]int{
+			"/api/v1/products?name=apple":                       {1, 3, 4},
+			"/api/v1/products?name=apple&in_stock=true":         {3, 4},
+			"/api/v1/products?min_price=100&max_price=200":      {2, 3},
+			"/api/v1/products?min_price=100&sort=name":          {2, 1, 3},
+			"/api/v1/products?name=apple&in_stock=1&sort=price": {4, 3},
+		}
+		for path, want := range tests {
+			rr := serve(server, "GET", path, "")
+
+			assert.Equal(t, http.StatusOK, rr.Code, path)
+			var products []model.Product
+			err := json.Unmarshal(rr.Body.Bytes(), &products)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, want, productIDs(products), path)
+			assert.Equal(t, strconv.Itoa(len(want)), rr.Header().Get("X-Total-Count"), path)
+		}
+	})
+}
+
+func TestGetProductsInvalidQuery(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore)
+
+		for _, query := range []string{"limit=0", "limit=101", "limit=x", "sort=stock", "cursor=!!", "min_price=x", "min_price=5&max_price=1", "in_stock=maybe"} {
+			rr := serve(server, "GET", "/api/v1/products?"+query, "")
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		}
+	})
+}
+
+func productIDs(products []model.Product) []int {
+	ids := []int{}
+	for _, product := range products {
+		ids = append(ids, product.ID)
 	}
+	return ids
+}
+
+func TestProductProblems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		tests := []struct {
+			method, path, body string
+			want               model.Problem
+		}{
+			{"GET", "/api/v1/products/abc", "", model.Problem{Type: model.ProblemInvalidID, Status: http.StatusBadRequest}},
+			{"GET", "/api/v1/products/999", "", model.Problem{Type: model.ProblemNotFound, Status: http.StatusNotFound}},
+			{"GET", "/api/v1/products?limit=x", "", model.Problem{Type: model.ProblemInvalidParameter, Status: http.StatusBadRequest}},
+			{"POST", "/api/v1/products", "{", model.Problem{Type: model.ProblemMalformedBody, Status: http.StatusBadRequest}},
+			{"POST", "/api/v1/products", `{"productName":""}`, model.Problem{Type: model.ProblemValidation, Status: http.StatusUnprocessableEntity}},
+			{"POST", "/api/v1/products", `{"id":1,"productName":"Product 1"}`, model.Problem{Type: model.ProblemConflict, Status: http.StatusConflict}},
+			{"DELETE", "/api/v1/products/abc", "", model.Problem{Type: model.ProblemInvalidID, Status: http.StatusBadRequest}},
+		}
+		for _, tt := range tests {
+			rr := serve(server, tt.method, tt.path, tt.body)
 
+			assert.Equal(t, tt.want.Status, rr.Code, tt.path)
+			assert.Equal(t, model.ProblemContentType, rr.Header().Get("Content-Type"), tt.path)
+
+			var problem model.Problem
+			err := json.Unmarshal(rr.Body.Bytes(), &problem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want.Type, problem.Type, tt.path)
+			assert.Equal(t, tt.want.Status, problem.Status, tt.path)
+			assert.NotEmpty(t, problem.Title, tt.path)
+			assert.NotEmpty(t, problem.Detail, tt.path)
+			assert.Equal(t, strings.Split(tt.path, "?")[0], problem.Instance, tt.path)
+		}
+	})
+}
+
+// conditionalGet sends a GET request with one conditional header
+func conditionalGet(handler http.Handler, path, header, value string) *httptest.ResponseRecorder {
+	return conditionalRequest(handler, "GET", path, "", header, value)
+}
+
+// conditionalRequest sends a request with one conditional header
+func conditionalRequest(handler http.Handler, method, path, body, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(header, value)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(provider1.GetProduct)
 	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetProductCaching(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "GET", "/api/v1/products/1", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		modified := rr.Header().Get("Last-Modified")
+		assert.Regexp(t, `^"[0-9a-f]+"$`, etag)
+		assert.NotEmpty(t, modified)
+
+		rr = conditionalGet(server, "/api/v1/products/1", "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+		rr = conditionalGet(server, "/api/v1/products/1", "If-Modified-Since", modified)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+
+		rr = conditionalGet(server, "/api/v1/products/1", "If-None-Match", `"other", W/`+etag)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+
+		rr = serve(server, "PATCH", "/api/v1/products/1", `{"stock":3,"version":1}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = conditionalGet(server, "/api/v1/products/1", "If-None-Match", etag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	})
+}
+
+func TestGetProductsCaching(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, _ := newServer(t, newStore,
+			model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10},
+			model.Product{ID: 2, ProductName: "Product 2", Price: 200, Stock: 20},
+		)
+
+		rr := serve(server, "GET", "/api/v1/products", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+		assert.Empty(t, rr.Header().Get("Last-Modified"))
+
+		rr = conditionalGet(server, "/api/v1/products", "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, "2", rr.Header().Get("X-Total-Count"))
+
+		// Without a Last-Modified the page is never validated by date
+		rr = conditionalGet(server, "/api/v1/products", "If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve(server, "DELETE", "/api/v1/products/2", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = conditionalGet(server, "/api/v1/products", "If-None-Match", etag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	})
+}
+
+func TestUpdateProductPreconditions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "GET", "/api/v1/products/1", "")
+		etag := rr.Header().Get("ETag")
+
+		// Neither If-Match nor a version
+		rr = serve(server, "PUT", "/api/v1/products/1", `{"productName":"Renamed","price":150,"stock":5}`)
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+		rr = serve(server, "PATCH", "/api/v1/products/1", `{"stock":5}`)
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+		// Current ETag, the weak form never matches
+		rr = conditionalRequest(server, "PATCH", "/api/v1/products/1", `{"stock":5}`, "If-Match", "W/"+etag)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		rr = conditionalRequest(server, "PATCH", "/api/v1/products/1", `{"stock":5}`, "If-Match", etag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// The ETag and version 1 are now stale
+		rr = conditionalRequest(server, "PUT", "/api/v1/products/1", `{"productName":"Renamed","price":150,"stock":5}`, "If-Match", etag)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		assert.Equal(t, model.ProblemContentType, rr.Header().Get("Content-Type"))
+		rr = serve(server, "PATCH", "/api/v1/products/1", `{"stock":7,"version":1}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		stored, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, stored.Stock)
+		assert.Equal(t, 2, stored.Version)
+
+		rr = conditionalRequest(server, "PUT", "/api/v1/products/1", `{"productName":"Renamed","price":150,"stock":5}`, "If-Match", "*")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = conditionalRequest(server, "PUT", "/api/v1/products/2", `{"productName":"Missing","price":150,"stock":5}`, "If-Match", "*")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestUpdateProductConcurrently(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		_, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		// Every writer starts from version 1, only one of them may win
+		const writers = 8
+		results := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			go func(stock int) {
+				version := 1
+				_, err := repo.Patch(1, model.ProductPatch{Stock: &stock, Version: &version})
+				results <- err
+			}(i)
+		}
 
-	assert.Equal(t, http.StatusNotFound, rr.Code)
+		var succeeded, conflicts int
+		for i := 0; i < writers; i++ {
+			err := <-results
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, model.ErrVersionMismatch):
+				conflicts++
+			default:
+				t.Error(err)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+		assert.Equal(t, writers-1, conflicts)
+	})
 }
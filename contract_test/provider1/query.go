@@ -0,0 +1,84 @@
+package provider1
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"model"
+	"net/url"
+	"strconv"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// parseProductQuery reads the pagination, sorting and filter parameters
+// of GET /products
+func parseProductQuery(values url.Values) (model.ProductQuery, error) {
+	query := model.ProductQuery{
+		Limit: model.DefaultLimit,
+		Sort:  values.Get("sort"),
+		Name:  values.Get("name"),
+	}
+
+	var err error
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("limit must be a number")
+		}
+	}
+	if v := values.Get("cursor"); v != "" {
+		if query.Offset, err = decodeCursor(v); err != nil {
+			return query, err
+		}
+	}
+	if query.MinPrice, err = intParam(values, "min_price"); err != nil {
+		return query, err
+	}
+	if query.MaxPrice, err = intParam(values, "max_price"); err != nil {
+		return query, err
+	}
+	if v := values.Get("in_stock"); v != "" {
+		if query.InStock, err = strconv.ParseBool(v); err != nil {
+			return query, fmt.Errorf("in_stock must be true or false")
+		}
+	}
+
+	return query, query.Validate()
+}
+
+func intParam(values url.Values, name string) (*int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &n, nil
+}
+
+// encodeCursor turns an offset into an opaque page cursor
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	var offset int
+	if _, err := fmt.Sscanf(string(raw), "offset:%d", &offset); err != nil || offset < 0 {
+		return 0, errInvalidCursor
+	}
+	return offset, nil
+}
+
+// pageURL returns the request URL pointing at the page of the given cursor
+func pageURL(u *url.URL, cursor string) string {
+	values := u.Query()
+	values.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return next.String()
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"sqlstore"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrate applies the embedded migrations that have not been applied yet,
+// each one in its own transaction
+func Migrate(db *sql.DB) error {
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+	return sqlstore.Migrate(db, migrations)
+}
@@ -0,0 +1,6 @@
+CREATE TABLE products (
+    id           INTEGER PRIMARY KEY,
+    product_name TEXT    NOT NULL,
+    price        INTEGER NOT NULL,
+    stock        INTEGER NOT NULL
+);
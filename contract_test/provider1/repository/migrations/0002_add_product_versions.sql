@@ -0,0 +1,4 @@
+ALTER TABLE products ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+
+UPDATE products SET updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
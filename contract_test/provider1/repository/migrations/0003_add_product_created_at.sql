@@ -0,0 +1,3 @@
+ALTER TABLE products ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+
+UPDATE products SET created_at = updated_at;
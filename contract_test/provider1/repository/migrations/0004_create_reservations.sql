@@ -0,0 +1,10 @@
+CREATE TABLE reservations (
+    id         INTEGER PRIMARY KEY,
+    product_id INTEGER NOT NULL,
+    quantity   INTEGER NOT NULL,
+    status     TEXT    NOT NULL,
+    created_at TEXT    NOT NULL,
+    expires_at TEXT    NOT NULL
+);
+
+CREATE INDEX reservations_status_expires_at ON reservations (status, expires_at);
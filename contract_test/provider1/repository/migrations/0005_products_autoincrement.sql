@@ -0,0 +1,18 @@
+-- AUTOINCREMENT keeps the IDs of deleted products from being handed out
+-- again, a pending reservation of a deleted product must not restock a new one
+CREATE TABLE products_autoincrement (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_name TEXT    NOT NULL,
+    price        INTEGER NOT NULL,
+    stock        INTEGER NOT NULL,
+    version      INTEGER NOT NULL DEFAULT 1,
+    updated_at   TEXT    NOT NULL DEFAULT '',
+    created_at   TEXT    NOT NULL DEFAULT ''
+);
+
+INSERT INTO products_autoincrement (id, product_name, price, stock, version, updated_at, created_at)
+    SELECT id, product_name, price, stock, version, updated_at, created_at FROM products;
+
+DROP TABLE products;
+
+ALTER TABLE products_autoincrement RENAME TO products;
@@ -1,31 +1,263 @@
 package repository
 
 import (
+	"fmt"
 	"model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ProductRepository is an in-memory db representation of our set of products
 type ProductRepository struct {
 	Products map[string]*model.Product
+
+	mu                sync.RWMutex
+	lastID            int
+	reservations      map[int]*model.Reservation
+	lastReservationID int
 }
 
-// GetProducts returns all products in the repository
-func (p *ProductRepository) GetProducts() []model.Product {
+// NewProductRepository creates a repository holding the given products,
+// products without a version are stored as version 1
+func NewProductRepository(products ...model.Product) *ProductRepository {
+	repo := &ProductRepository{Products: make(map[string]*model.Product, len(products))}
+	for _, product := range products {
+		stored := product
+		if stored.Version == 0 {
+			touch(&stored, 1)
+		}
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = stored.UpdatedAt
+		}
+		repo.Products[fmt.Sprintf("product%d", product.ID)] = &stored
+		repo.lastID = max(repo.lastID, product.ID)
+	}
+	return repo
+}
+
+// GetProducts returns all products in the repository ordered by ID
+func (p *ProductRepository) GetProducts() ([]model.Product, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	var response []model.Product
 
 	for _, product := range p.Products {
 		response = append(response, *product)
 	}
 
-	return response
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].ID < response[j].ID
+	})
+
+	return response, nil
+}
+
+// FindProducts returns one page of the products matching the query
+// together with the number of matching products
+func (p *ProductRepository) FindProducts(query model.ProductQuery) ([]model.Product, int, error) {
+	if err := query.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var matched []model.Product
+	for _, product := range p.Products {
+		if matches(*product, query) {
+			matched = append(matched, *product)
+		}
+	}
+	sortProducts(matched, query.Sort)
+
+	total := len(matched)
+	if query.Offset >= total {
+		return []model.Product{}, total, nil
+	}
+	end := min(query.Offset+query.Limit, total)
+
+	return matched[query.Offset:end], total, nil
 }
 
 // ByID finds a product by their ID
 func (p *ProductRepository) ByID(ID int) (*model.Product, error) {
-	for _, product := range p.Products {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keyByID(ID)
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	product := *p.Products[key]
+	return &product, nil
+}
+
+// Create stores a new product, a zero ID is replaced by one never used before
+func (p *ProductRepository) Create(product model.Product) (*model.Product, error) {
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if product.ID == 0 {
+		product.ID = p.nextID()
+	} else if _, ok := p.keyByID(product.ID); ok {
+		return nil, fmt.Errorf("product %d: %w", product.ID, model.ErrConflict)
+	}
+	touch(&product, 1)
+	product.CreatedAt = product.UpdatedAt
+
+	if p.Products == nil {
+		p.Products = make(map[string]*model.Product)
+	}
+	stored := product
+	p.Products[fmt.Sprintf("product%d", product.ID)] = &stored
+	p.lastID = max(p.lastID, product.ID)
+
+	return &product, nil
+}
+
+// Update replaces an existing product, a non-zero version must match the
+// stored one
+func (p *ProductRepository) Update(product model.Product) (*model.Product, error) {
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keyByID(product.ID)
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	current := p.Products[key]
+	if err := checkVersion(current, product.Version); err != nil {
+		return nil, err
+	}
+	product.CreatedAt = current.CreatedAt
+	touch(&product, current.Version+1)
+	stored := product
+	p.Products[key] = &stored
+
+	return &product, nil
+}
+
+// Patch applies a partial update to an existing product, the patch
+// version must match the stored one when set
+func (p *ProductRepository) Patch(ID int, patch model.ProductPatch) (*model.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keyByID(ID)
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	product := *p.Products[key]
+	if patch.Version != nil {
+		if err := checkVersion(&product, *patch.Version); err != nil {
+			return nil, err
+		}
+	}
+	patch.Apply(&product)
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+	touch(&product, product.Version+1)
+	stored := product
+	p.Products[key] = &stored
+
+	return &product, nil
+}
+
+// Delete removes a product by its ID
+func (p *ProductRepository) Delete(ID int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keyByID(ID)
+	if !ok {
+		return model.ErrNotFound
+	}
+	delete(p.Products, key)
+
+	return nil
+}
+
+// keyByID returns the map key of the product with the given ID,
+// the caller must hold the lock
+func (p *ProductRepository) keyByID(ID int) (string, bool) {
+	for key, product := range p.Products {
 		if product.ID == ID {
-			return product, nil
+			return key, true
 		}
 	}
-	return nil, model.ErrNotFound
+	return "", false
+}
+
+// nextID returns the ID following the highest one ever stored, so that the
+// ID of a deleted product is not reused. The caller must hold the lock
+func (p *ProductRepository) nextID() int {
+	p.lastID++
+	return p.lastID
+}
+
+// touch sets the version of a product being written and its update time
+func touch(product *model.Product, version int) {
+	product.Version = version
+	product.UpdatedAt = time.Now().UTC()
+}
+
+// checkVersion returns model.ErrVersionMismatch when the expected version
+// is set and the product moved past it
+func checkVersion(product *model.Product, expected int) error {
+	if expected != 0 && expected != product.Version {
+		return fmt.Errorf("product %d is at version %d, not %d: %w", product.ID, product.Version, expected, model.ErrVersionMismatch)
+	}
+	return nil
+}
+
+func matches(product model.Product, query model.ProductQuery) bool {
+	if query.MinPrice != nil && product.Price < *query.MinPrice {
+		return false
+	}
+	if query.MaxPrice != nil && product.Price > *query.MaxPrice {
+		return false
+	}
+	if query.InStock && product.Stock <= 0 {
+		return false
+	}
+	if query.Name != "" && !strings.Contains(strings.ToLower(product.ProductName), strings.ToLower(query.Name)) {
+		return false
+	}
+	return true
+}
+
+// sortProducts orders products by one of model.ProductSorts, ties are broken by ID
+func sortProducts(products []model.Product, order string) {
+	desc := strings.HasPrefix(order, "-")
+	field := strings.TrimPrefix(order, "-")
+
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		if desc {
+			a, b = b, a
+		}
+		switch field {
+		case "name":
+			if a.ProductName != b.ProductName {
+				return a.ProductName < b.ProductName
+			}
+		case "price":
+			if a.Price != b.Price {
+				return a.Price < b.Price
+			}
+		}
+		return a.ID < b.ID
+	})
 }
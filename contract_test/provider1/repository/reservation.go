@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"fmt"
+	"model"
+	"sort"
+	"time"
+)
+
+// Reserve takes quantity from the stock of a product and holds it for ttl
+func (p *ProductRepository) Reserve(productID, quantity int, ttl time.Duration) (*model.Reservation, error) {
+	if quantity < 1 {
+		return nil, fmt.Errorf("quantity must be at least 1: %w", model.ErrInvalid)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keyByID(productID)
+	if !ok {
+		return nil, fmt.Errorf("product %d: %w", productID, model.ErrNotFound)
+	}
+	product := *p.Products[key]
+	if product.Stock < quantity {
+		return nil, fmt.Errorf("product %d has %d in stock, %d requested: %w",
+			productID, product.Stock, quantity, model.ErrInsufficientStock)
+	}
+	product.Stock -= quantity
+	touch(&product, product.Version+1)
+	p.Products[key] = &product
+
+	if p.reservations == nil {
+		p.reservations = make(map[int]*model.Reservation)
+	}
+	p.lastReservationID++
+	reservation := model.Reservation{
+		ID:        p.lastReservationID,
+		ProductID: productID,
+		Quantity:  quantity,
+		Status:    model.ReservationPending,
+		CreatedAt: product.UpdatedAt,
+		ExpiresAt: product.UpdatedAt.Add(ttl),
+	}
+	stored := reservation
+	p.reservations[reservation.ID] = &stored
+
+	return &reservation, nil
+}
+
+// Reservation finds a reservation of a product by its ID
+func (p *ProductRepository) Reservation(productID, ID int) (*model.Reservation, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	reservation, err := p.reservation(productID, ID)
+	if err != nil {
+		return nil, err
+	}
+	found := *reservation
+	return &found, nil
+}
+
+// CommitReservation consumes the stock held by a pending reservation,
+// an expired one is left for ExpireReservations to release
+func (p *ProductRepository) CommitReservation(productID, ID int) (*model.Reservation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reservation, err := p.reservation(productID, ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCommittable(reservation, time.Now()); err != nil {
+		return nil, err
+	}
+	if reservation.Status != model.ReservationPending {
+		return nil, fmt.Errorf("reservation %d is %s: %w", ID, reservation.Status, model.ErrReservationClosed)
+	}
+	reservation.Status = model.ReservationCommitted
+
+	committed := *reservation
+	return &committed, nil
+}
+
+// ReleaseReservation gives the stock held by a pending reservation back
+func (p *ProductRepository) ReleaseReservation(productID, ID int) (*model.Reservation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reservation, err := p.reservation(productID, ID)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status != model.ReservationPending {
+		return nil, fmt.Errorf("reservation %d is %s: %w", ID, reservation.Status, model.ErrReservationClosed)
+	}
+	p.closeReservation(reservation, model.ReservationReleased)
+
+	released := *reservation
+	return &released, nil
+}
+
+// ExpireReservations gives back the stock of the pending reservations
+// expired at now and returns them
+func (p *ProductRepository) ExpireReservations(now time.Time) ([]model.Reservation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var expired []model.Reservation
+	for _, reservation := range p.reservations {
+		if reservation.Status == model.ReservationPending && !now.Before(reservation.ExpiresAt) {
+			p.closeReservation(reservation, model.ReservationExpired)
+			expired = append(expired, *reservation)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ID < expired[j].ID
+	})
+	return expired, nil
+}
+
+// checkCommittable returns model.ErrReservationClosed for a pending
+// reservation past its expiry
+func checkCommittable(reservation *model.Reservation, now time.Time) error {
+	if reservation.Status == model.ReservationPending && !now.Before(reservation.ExpiresAt) {
+		return fmt.Errorf("reservation %d expired at %s: %w",
+			reservation.ID, reservation.ExpiresAt.Format(time.RFC3339), model.ErrReservationClosed)
+	}
+	return nil
+}
+
+// reservation returns the stored reservation, the caller must hold the lock
+func (p *ProductRepository) reservation(productID, ID int) (*model.Reservation, error) {
+	reservation, ok := p.reservations[ID]
+	if !ok || reservation.ProductID != productID {
+		return nil, fmt.Errorf("reservation %d of product %d: %w", ID, productID, model.ErrReservationNotFound)
+	}
+	return reservation, nil
+}
+
+// closeReservation returns the stock of a pending reservation to its
+// product, the caller must hold the lock
+func (p *ProductRepository) closeReservation(reservation *model.Reservation, status model.ReservationStatus) {
+	reservation.Status = status
+
+	key, ok := p.keyByID(reservation.ProductID)
+	if !ok || p.Products[key].CreatedAt.After(reservation.CreatedAt) {
+		// The product was deleted, or its ID given to a product created later
+		return
+	}
+	product := *p.Products[key]
+	product.Stock += reservation.Quantity
+	touch(&product, product.Version+1)
+	p.Products[key] = &product
+}
@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"model"
+	"sqlstore"
+	"strings"
+
+	_ "modernc.org/sqlite" // pure Go SQLite driver, no cgo needed
+)
+
+// SQLiteProductRepository stores products in an embedded SQLite database
+type SQLiteProductRepository struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (or creates) the SQLite database at path and applies
+// any pending schema migrations
+func OpenSQLite(path string) (*SQLiteProductRepository, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteProductRepository{db: db}, nil
+}
+
+// Close closes the underlying database
+func (p *SQLiteProductRepository) Close() error {
+	return p.db.Close()
+}
+
+// GetProducts returns all products in the repository ordered by ID
+func (p *SQLiteProductRepository) GetProducts() ([]model.Product, error) {
+	rows, err := p.db.Query(`SELECT ` + productColumns + ` FROM products ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var response []model.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, *product)
+	}
+
+	return response, rows.Err()
+}
+
+// sqliteOrderBy maps model.ProductSorts to ORDER BY clauses, ties are broken by ID
+var sqliteOrderBy = map[string]string{
+	"":       "id",
+	"id":     "id",
+	"-id":    "id DESC",
+	"name":   "product_name, id",
+	"-name":  "product_name DESC, id DESC",
+	"price":  "price, id",
+	"-price": "price DESC, id DESC",
+}
+
+// FindProducts returns one page of the products matching the query
+// together with the number of matching products
+func (p *SQLiteProductRepository) FindProducts(query model.ProductQuery) ([]model.Product, int, error) {
+	if err := query.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	var where []string
+	var args []any
+	if query.MinPrice != nil {
+		where = append(where, "price >= ?")
+		args = append(args, *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		where = append(where, "price <= ?")
+		args = append(args, *query.MaxPrice)
+	}
+	if query.InStock {
+		where = append(where, "stock > 0")
+	}
+	if query.Name != "" {
+		where = append(where, `product_name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(query.Name)+"%")
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM products`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := p.db.Query(`SELECT `+productColumns+` FROM products`+filter+
+		` ORDER BY `+sqliteOrderBy[query.Sort]+` LIMIT ? OFFSET ?`,
+		append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	response := []model.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		response = append(response, *product)
+	}
+
+	return response, total, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards in a substring search
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ByID finds a product by their ID
+func (p *SQLiteProductRepository) ByID(ID int) (*model.Product, error) {
+	return byID(p.db, ID)
+}
+
+// Create stores a new product, a zero ID is replaced by one never used before
+func (p *SQLiteProductRepository) Create(product model.Product) (*model.Product, error) {
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if product.ID != 0 {
+		_, err := byID(tx, product.ID)
+		if err == nil {
+			return nil, fmt.Errorf("product %d: %w", product.ID, model.ErrConflict)
+		}
+		if !errors.Is(err, model.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	var id sql.NullInt64
+	if product.ID != 0 {
+		id = sql.NullInt64{Int64: int64(product.ID), Valid: true}
+	}
+	touch(&product, 1)
+	product.CreatedAt = product.UpdatedAt
+	res, err := tx.Exec(`INSERT INTO products (id, product_name, price, stock, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, product.ProductName, product.Price, product.Stock, product.Version,
+		sqlstore.FormatTime(product.CreatedAt), sqlstore.FormatTime(product.UpdatedAt))
+	if err != nil {
+		return nil, err
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	product.ID = int(lastID)
+
+	return &product, tx.Commit()
+}
+
+// Update replaces an existing product, a non-zero version must match the
+// stored one
+func (p *SQLiteProductRepository) Update(product model.Product) (*model.Product, error) {
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := byID(tx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(current, product.Version); err != nil {
+		return nil, err
+	}
+	product.CreatedAt = current.CreatedAt
+	touch(&product, current.Version+1)
+
+	if err := update(tx, product); err != nil {
+		return nil, err
+	}
+
+	return &product, tx.Commit()
+}
+
+// Patch applies a partial update to an existing product
+func (p *SQLiteProductRepository) Patch(ID int, patch model.ProductPatch) (*model.Product, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	product, err := byID(tx, ID)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Version != nil {
+		if err := checkVersion(product, *patch.Version); err != nil {
+			return nil, err
+		}
+	}
+	patch.Apply(product)
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+	touch(product, product.Version+1)
+
+	if err := update(tx, *product); err != nil {
+		return nil, err
+	}
+
+	return product, tx.Commit()
+}
+
+// Delete removes a product by its ID
+func (p *SQLiteProductRepository) Delete(ID int) error {
+	res, err := p.db.Exec(`DELETE FROM products WHERE id = ?`, ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// update writes every column of a product
+func update(tx *sql.Tx, product model.Product) error {
+	_, err := tx.Exec(`UPDATE products SET product_name = ?, price = ?, stock = ?, version = ?, updated_at = ? WHERE id = ?`,
+		product.ProductName, product.Price, product.Stock, product.Version, sqlstore.FormatTime(product.UpdatedAt), product.ID)
+	return err
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func byID(q queryer, ID int) (*model.Product, error) {
+	product, err := scanProduct(q.QueryRow(`SELECT `+productColumns+` FROM products WHERE id = ?`, ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, model.ErrNotFound
+	}
+	return product, err
+}
+
+// productColumns are the columns read by scanProduct
+const productColumns = `id, product_name, price, stock, version, created_at, updated_at`
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanProduct(row scanner) (*model.Product, error) {
+	var product model.Product
+	var createdAt, updatedAt string
+	err := row.Scan(&product.ID, &product.ProductName, &product.Price, &product.Stock, &product.Version, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if product.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("product %d: created_at: %w", product.ID, err)
+	}
+	if product.UpdatedAt, err = sqlstore.ParseTime(updatedAt); err != nil {
+		return nil, fmt.Errorf("product %d: updated_at: %w", product.ID, err)
+	}
+	return &product, nil
+}
+
+// expectAffected returns model.ErrNotFound when no row was changed
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"model"
+	"sqlstore"
+	"time"
+)
+
+// Reserve takes quantity from the stock of a product and holds it for ttl
+func (p *SQLiteProductRepository) Reserve(productID, quantity int, ttl time.Duration) (*model.Reservation, error) {
+	if quantity < 1 {
+		return nil, fmt.Errorf("quantity must be at least 1: %w", model.ErrInvalid)
+	}
+
+	// The transaction takes the write lock up front (_txlock=immediate),
+	// so the stock cannot change between the check and the update
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	product, err := byID(tx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("product %d: %w", productID, err)
+	}
+	if product.Stock < quantity {
+		return nil, fmt.Errorf("product %d has %d in stock, %d requested: %w",
+			productID, product.Stock, quantity, model.ErrInsufficientStock)
+	}
+	product.Stock -= quantity
+	touch(product, product.Version+1)
+	if err := update(tx, *product); err != nil {
+		return nil, err
+	}
+
+	reservation := model.Reservation{
+		ProductID: productID,
+		Quantity:  quantity,
+		Status:    model.ReservationPending,
+		CreatedAt: product.UpdatedAt,
+		ExpiresAt: product.UpdatedAt.Add(ttl),
+	}
+	res, err := tx.Exec(`INSERT INTO reservations (product_id, quantity, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		reservation.ProductID, reservation.Quantity, reservation.Status,
+		sqlstore.FormatTime(reservation.CreatedAt), sqlstore.FormatTime(reservation.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	reservation.ID = int(id)
+
+	return &reservation, tx.Commit()
+}
+
+// Reservation finds a reservation of a product by its ID
+func (p *SQLiteProductRepository) Reservation(productID, ID int) (*model.Reservation, error) {
+	return reservationByID(p.db, productID, ID)
+}
+
+// CommitReservation consumes the stock held by a pending reservation,
+// an expired one is left for ExpireReservations to release
+func (p *SQLiteProductRepository) CommitReservation(productID, ID int) (*model.Reservation, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := reservationByID(tx, productID, ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCommittable(reservation, time.Now()); err != nil {
+		return nil, err
+	}
+	if reservation.Status != model.ReservationPending {
+		return nil, fmt.Errorf("reservation %d is %s: %w", ID, reservation.Status, model.ErrReservationClosed)
+	}
+
+	reservation.Status = model.ReservationCommitted
+	if err := setReservationStatus(tx, reservation); err != nil {
+		return nil, err
+	}
+
+	return reservation, tx.Commit()
+}
+
+// ReleaseReservation gives the stock held by a pending reservation back
+func (p *SQLiteProductRepository) ReleaseReservation(productID, ID int) (*model.Reservation, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := reservationByID(tx, productID, ID)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status != model.ReservationPending {
+		return nil, fmt.Errorf("reservation %d is %s: %w", ID, reservation.Status, model.ErrReservationClosed)
+	}
+	if err := closeReservation(tx, reservation, model.ReservationReleased); err != nil {
+		return nil, err
+	}
+
+	return reservation, tx.Commit()
+}
+
+// ExpireReservations gives back the stock of the pending reservations
+// expired at now and returns them
+func (p *SQLiteProductRepository) ExpireReservations(now time.Time) ([]model.Reservation, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+reservationColumns+` FROM reservations WHERE status = ? AND expires_at <= ? ORDER BY id`,
+		model.ReservationPending, sqlstore.FormatTime(now))
+	if err != nil {
+		return nil, err
+	}
+	var expired []model.Reservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired = append(expired, *reservation)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range expired {
+		if err := closeReservation(tx, &expired[i], model.ReservationExpired); err != nil {
+			return nil, err
+		}
+	}
+
+	return expired, tx.Commit()
+}
+
+// closeReservation returns the stock of a pending reservation to its product
+func closeReservation(tx *sql.Tx, reservation *model.Reservation, status model.ReservationStatus) error {
+	reservation.Status = status
+	if err := setReservationStatus(tx, reservation); err != nil {
+		return err
+	}
+
+	product, err := byID(tx, reservation.ProductID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if product.CreatedAt.After(reservation.CreatedAt) {
+		// The ID was given to a product created after the reservation
+		return nil
+	}
+	product.Stock += reservation.Quantity
+	touch(product, product.Version+1)
+	return update(tx, *product)
+}
+
+func setReservationStatus(tx *sql.Tx, reservation *model.Reservation) error {
+	_, err := tx.Exec(`UPDATE reservations SET status = ? WHERE id = ?`, reservation.Status, reservation.ID)
+	return err
+}
+
+// reservationColumns are the columns read by scanReservation
+const reservationColumns = `id, product_id, quantity, status, created_at, expires_at`
+
+func reservationByID(q queryer, productID, ID int) (*model.Reservation, error) {
+	reservation, err := scanReservation(q.QueryRow(`SELECT `+reservationColumns+` FROM reservations WHERE id = ? AND product_id = ?`, ID, productID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("reservation %d of product %d: %w", ID, productID, model.ErrReservationNotFound)
+	}
+	return reservation, err
+}
+
+func scanReservation(row scanner) (*model.Reservation, error) {
+	var reservation model.Reservation
+	var createdAt, expiresAt string
+	err := row.Scan(&reservation.ID, &reservation.ProductID, &reservation.Quantity, &reservation.Status, &createdAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("reservation %d: created_at: %w", reservation.ID, err)
+	}
+	if reservation.ExpiresAt, err = sqlstore.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("reservation %d: expires_at: %w", reservation.ID, err)
+	}
+	return &reservation, nil
+}
@@ -0,0 +1,92 @@
+package repository_test
+
+import (
+	"model"
+	"path/filepath"
+	"provider1/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteProductRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.db")
+
+	repo, err := repository.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := repo.Create(model.Product{ProductName: "Product 1", Price: 100, Stock: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.ID)
+	assert.NoError(t, repo.Close())
+
+	// Reopening runs the migrations again, they must be skipped
+	repo, err = repository.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	product, err := repo.ByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10, Version: 1, CreatedAt: created.CreatedAt, UpdatedAt: created.UpdatedAt}, *product)
+}
+
+func TestSQLiteProductRepositoryVersions(t *testing.T) {
+	repo, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	created, err := repo.Create(model.Product{ProductName: "Product 1", Price: 100, Stock: 10, Version: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.Version)
+
+	updated, err := repo.Update(model.Product{ID: created.ID, ProductName: "Product 1", Price: 150, Stock: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+
+	stock := 3
+	patched, err := repo.Patch(created.ID, model.ProductPatch{Stock: &stock})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, patched.Version)
+
+	assert.Equal(t, created.CreatedAt, patched.CreatedAt)
+
+	stale := 2
+	_, err = repo.Patch(created.ID, model.ProductPatch{Stock: &stock, Version: &stale})
+	assert.ErrorIs(t, err, model.ErrVersionMismatch)
+	_, err = repo.Update(model.Product{ID: created.ID, ProductName: "Product 1", Version: stale})
+	assert.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	stored, err := repo.ByID(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, *patched, *stored)
+}
+
+func TestSQLiteProductRepositoryErrors(t *testing.T) {
+	repo, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	_, err = repo.ByID(1)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = repo.Update(model.Product{ID: 1, ProductName: "Product 1"})
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	assert.ErrorIs(t, repo.Delete(1), model.ErrNotFound)
+
+	_, err = repo.Create(model.Product{ID: 5, ProductName: "Product 5"})
+	assert.NoError(t, err)
+	_, err = repo.Create(model.Product{ID: 5, ProductName: "Product 5"})
+	assert.ErrorIs(t, err, model.ErrConflict)
+
+	_, err = repo.Create(model.Product{ProductName: ""})
+	assert.ErrorIs(t, err, model.ErrEmpty)
+}
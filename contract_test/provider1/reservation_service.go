@@ -0,0 +1,156 @@
+package provider1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"model"
+	"net/http"
+	"time"
+)
+
+// CreateReservation handles the HTTP request to reserve stock of a product
+// @Summary Reserve stock
+// @Description Take stock of a product and hold it until the reservation is committed, released or expires
+// @Tags reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param reservation body model.ReservationRequest true "Quantity and TTL"
+// @Success 201 {object} model.Reservation
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Failure 409 {object} model.Problem
+// @Failure 422 {object} model.Problem
+// @Router /products/{id}/reservations [post]
+func (h *ProductHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	var req model.ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, fmt.Errorf("%w: %w", errMalformedBody, err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	reservation, err := h.store.Reserve(id, req.Quantity, req.TTL())
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	h.publishReservationStock(r.Context(), *reservation, -reservation.Quantity, model.StockReasonReservation)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/products/%d/reservations/%d", id, reservation.ID))
+	writeJSON(w, http.StatusCreated, reservation)
+}
+
+// GetReservation handles the HTTP request to retrieve a reservation
+// @Summary Get a reservation
+// @Description Get a stock reservation of a product by its ID
+// @Tags reservations
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param reservationID path int true "Reservation ID"
+// @Success 200 {object} model.Reservation
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Router /products/{id}/reservations/{reservationID} [get]
+func (h *ProductHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	h.reservationAction(w, r, h.store.Reservation)
+}
+
+// CommitReservation handles the HTTP request to commit a reservation
+// @Summary Commit a reservation
+// @Description Consume the stock held by a pending reservation
+// @Tags reservations
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param reservationID path int true "Reservation ID"
+// @Success 200 {object} model.Reservation
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Failure 409 {object} model.Problem
+// @Router /products/{id}/reservations/{reservationID}/commit [post]
+func (h *ProductHandler) CommitReservation(w http.ResponseWriter, r *http.Request) {
+	h.reservationAction(w, r, h.store.CommitReservation)
+}
+
+// ReleaseReservation handles the HTTP request to release a reservation
+// @Summary Release a reservation
+// @Description Give the stock held by a pending reservation back
+// @Tags reservations
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param reservationID path int true "Reservation ID"
+// @Success 200 {object} model.Reservation
+// @Failure 400 {object} model.Problem
+// @Failure 404 {object} model.Problem
+// @Failure 409 {object} model.Problem
+// @Router /products/{id}/reservations/{reservationID}/release [post]
+func (h *ProductHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	h.reservationAction(w, r, func(productID, ID int) (*model.Reservation, error) {
+		reservation, err := h.store.ReleaseReservation(productID, ID)
+		if err == nil {
+			h.publishReservationStock(r.Context(), *reservation, reservation.Quantity, model.StockReasonRelease)
+		}
+		return reservation, err
+	})
+}
+
+// reservationAction reads the product and reservation IDs from the URL,
+// applies action to them and writes the resulting reservation
+func (h *ProductHandler) reservationAction(w http.ResponseWriter, r *http.Request, action func(productID, ID int) (*model.Reservation, error)) {
+	id, err := productID(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	reservationID, err := pathID(r, "reservations")
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	reservation, err := action(id, reservationID)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+// SweepReservations expires overdue reservations every interval,
+// giving their stock back, until ctx is done
+func (h *ProductHandler) SweepReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := h.store.ExpireReservations(now)
+			if err != nil {
+				log.Println("Failed to expire reservations:", err)
+				continue
+			}
+			if len(expired) > 0 {
+				log.Printf("Expired %d reservations", len(expired))
+			}
+			for _, reservation := range expired {
+				h.publishReservationStock(ctx, reservation, reservation.Quantity, model.StockReasonExpiry)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package provider1_test
+
+import (
+	"encoding/json"
+	"model"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeReservation(t *testing.T, body []byte) model.Reservation {
+	var reservation model.Reservation
+	if err := json.Unmarshal(body, &reservation); err != nil {
+		t.Fatal(err)
+	}
+	return reservation
+}
+
+func TestReserveStock(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		rr := serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":3,"ttlSeconds":60}`)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		reservation := decodeReservation(t, rr.Body.Bytes())
+		assert.Equal(t, "/api/v1/products/1/reservations/1", rr.Header().Get("Location"))
+		assert.Equal(t, model.ReservationPending, reservation.Status)
+		assert.Equal(t, 3, reservation.Quantity)
+		assert.Equal(t, time.Minute, reservation.ExpiresAt.Sub(reservation.CreatedAt))
+
+		product, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, product.Stock)
+		assert.Equal(t, 2, product.Version)
+
+		rr = serve(server, "GET", "/api/v1/products/1/reservations/1", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, reservation.ID, decodeReservation(t, rr.Body.Bytes()).ID)
+	})
+}
+
+func TestReserveStockProblems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore,
+			model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 2},
+			model.Product{ID: 2, ProductName: "Product 2", Price: 100, Stock: 2},
+		)
+
+		tests := []struct {
+			method, path, body string
+			want               model.Problem
+		}{
+			{"POST", "/api/v1/products/1/reservations", `{"quantity":3}`, model.Problem{Type: model.ProblemInsufficientStock, Status: http.StatusConflict}},
+			{"POST", "/api/v1/products/1/reservations", `{"quantity":0}`, model.Problem{Type: model.ProblemValidation, Status: http.StatusUnprocessableEntity}},
+			{"POST", "/api/v1/products/1/reservations", `{"quantity":1,"ttlSeconds":-1}`, model.Problem{Type: model.ProblemValidation, Status: http.StatusUnprocessableEntity}},
+			{"POST", "/api/v1/products/1/reservations", `{"quantity":1,"ttlSeconds":86401}`, model.Problem{Type: model.ProblemValidation, Status: http.StatusUnprocessableEntity}},
+			{"POST", "/api/v1/products/1/reservations", `{"quantity":1,"ttlSeconds":9223372037}`, model.Problem{Type: model.ProblemValidation, Status: http.StatusUnprocessableEntity}},
+			{"POST", "/api/v1/products/1/reservations", `{`, model.Problem{Type: model.ProblemMalformedBody, Status: http.StatusBadRequest}},
+			{"POST", "/api/v1/products/9/reservations", `{"quantity":1}`, model.Problem{Type: model.ProblemNotFound, Status: http.StatusNotFound}},
+			{"GET", "/api/v1/products/1/reservations/9", "", model.Problem{Type: model.ProblemNotFound, Status: http.StatusNotFound}},
+			{"POST", "/api/v1/products/1/reservations/abc/commit", "", model.Problem{Type: model.ProblemInvalidID, Status: http.StatusBadRequest}},
+		}
+		for _, tt := range tests {
+			rr := serve(server, tt.method, tt.path, tt.body)
+
+			assert.Equal(t, tt.want.Status, rr.Code, tt.path)
+			var problem model.Problem
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want.Type, problem.Type, tt.path)
+		}
+
+		// A reservation is only found under its own product
+		rr := serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":1}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		rr = serve(server, "POST", "/api/v1/products/2/reservations/1/release", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		product, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, product.Stock)
+	})
+}
+
+func TestCommitAndReleaseReservation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":4}`)
+		serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":2}`)
+
+		rr := serve(server, "POST", "/api/v1/products/1/reservations/1/commit", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, model.ReservationCommitted, decodeReservation(t, rr.Body.Bytes()).Status)
+
+		rr = serve(server, "POST", "/api/v1/products/1/reservations/2/release", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, model.ReservationReleased, decodeReservation(t, rr.Body.Bytes()).Status)
+
+		// Neither can change again
+		for _, path := range []string{"/api/v1/products/1/reservations/1/release", "/api/v1/products/1/reservations/2/commit"} {
+			rr = serve(server, "POST", path, "")
+			assert.Equal(t, http.StatusConflict, rr.Code, path)
+		}
+
+		product, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 6, product.Stock)
+	})
+}
+
+func TestExpireReservations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":4,"ttlSeconds":60}`)
+		serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":2,"ttlSeconds":3600}`)
+
+		expired, err := repo.ExpireReservations(time.Now().Add(10 * time.Minute))
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assert.Equal(t, 4, expired[0].Quantity)
+
+		product, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, product.Stock)
+
+		rr := serve(server, "POST", "/api/v1/products/1/reservations/1/commit", "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		rr = serve(server, "GET", "/api/v1/products/1/reservations/1", "")
+		assert.Equal(t, model.ReservationExpired, decodeReservation(t, rr.Body.Bytes()).Status)
+
+		rr = serve(server, "POST", "/api/v1/products/1/reservations/2/commit", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestCloseReservationOfDeletedProduct(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore,
+			model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10},
+			model.Product{ID: 2, ProductName: "Product 2", Price: 200, Stock: 10},
+		)
+
+		serve(server, "POST", "/api/v1/products/2/reservations", `{"quantity":4}`)
+		serve(server, "POST", "/api/v1/products/2/reservations", `{"quantity":3,"ttlSeconds":60}`)
+		rr := serve(server, "DELETE", "/api/v1/products/2", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		// The ID of the deleted product is not handed out again
+		rr = serve(server, "POST", "/api/v1/products", `{"productName":"Product 3","price":300,"stock":5}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "/api/v1/products/3", rr.Header().Get("Location"))
+
+		rr = serve(server, "POST", "/api/v1/products/2/reservations/1/release", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// A product created later with the same ID is not restocked either
+		rr = serve(server, "POST", "/api/v1/products", `{"id":2,"productName":"Product 2","price":200,"stock":5}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		expired, err := repo.ExpireReservations(time.Now().Add(10 * time.Minute))
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+
+		for _, id := range []int{2, 3} {
+			product, err := repo.ByID(id)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, product.Stock, id)
+		}
+	})
+}
+
+func TestReserveStockConcurrently(t *testing.T) {
+	forEachStore(t, func(t *testing.T, newStore newStoreFunc) {
+		server, repo := newServer(t, newStore, model.Product{ID: 1, ProductName: "Product 1", Price: 100, Stock: 10})
+
+		const requests = 25
+		codes := make(chan int, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- serve(server, "POST", "/api/v1/products/1/reservations", `{"quantity":1}`).Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		count := map[int]int{}
+		for code := range codes {
+			count[code]++
+		}
+		assert.Equal(t, map[int]int{http.StatusCreated: 10, http.StatusConflict: requests - 10}, count)
+
+		product, err := repo.ByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, product.Stock)
+	})
+}
@@ -0,0 +1,92 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sqlstore"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateAppliesInVersionOrder(t *testing.T) {
+	db := openDB(t)
+	migrations := fstest.MapFS{
+		"0010_add_price.sql":    {Data: []byte(`ALTER TABLE items ADD COLUMN price INTEGER NOT NULL DEFAULT 0`)},
+		"0002_create_items.sql": {Data: []byte(`CREATE TABLE items (id INTEGER PRIMARY KEY)`)},
+		"README.md":             {Data: []byte(`not a migration`)},
+	}
+
+	// Act, the second run skips the applied migrations
+	assert.NoError(t, sqlstore.Migrate(db, migrations))
+	assert.NoError(t, sqlstore.Migrate(db, migrations))
+
+	// Assert
+	var versions []int
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	assert.NoError(t, err)
+	for rows.Next() {
+		var version int
+		assert.NoError(t, rows.Scan(&version))
+		versions = append(versions, version)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []int{2, 10}, versions)
+	_, err = db.Exec(`INSERT INTO items (id, price) VALUES (1, 100)`)
+	assert.NoError(t, err)
+}
+
+func TestMigrateErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations fstest.MapFS
+		want       string
+	}{
+		{"invalid version", fstest.MapFS{"first.sql": {Data: []byte(`SELECT 1`)}}, "migration first.sql: invalid version"},
+		{"invalid SQL", fstest.MapFS{"0001_broken.sql": {Data: []byte(`CREATE TABL items`)}}, "migration 0001_broken:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+
+			err := sqlstore.Migrate(db, tt.migrations)
+
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db := openDB(t)
+	migrations := fstest.MapFS{
+		"0001_create_items.sql": {Data: []byte(`CREATE TABLE items (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1)`)},
+	}
+
+	assert.Error(t, sqlstore.Migrate(db, migrations))
+
+	var tables int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'items'`).Scan(&tables))
+	assert.Equal(t, 0, tables)
+}
+
+func TestFormatTimeSortsChronologically(t *testing.T) {
+	earlier := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := earlier.Add(time.Millisecond)
+
+	assert.Less(t, sqlstore.FormatTime(earlier), sqlstore.FormatTime(later))
+	parsed, err := sqlstore.ParseTime(sqlstore.FormatTime(later.In(time.FixedZone("CET", 3600))))
+	assert.NoError(t, err)
+	assert.True(t, later.Equal(parsed))
+}
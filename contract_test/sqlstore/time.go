@@ -0,0 +1,17 @@
+package sqlstore
+
+import "time"
+
+// TimeLayout is a fixed width RFC 3339 layout, so that stored times sort
+// in chronological order and compare as strings
+const TimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// FormatTime formats a timestamp the way ParseTime parses it
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseTime parses a stored timestamp
+func ParseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,14 @@
+module config
+
+go 1.23.0
+
+require (
+	github.com/pelletier/go-toml/v2 v2.2.4
+	github.com/stretchr/testify v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sqlstore"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyPurgeInterval  = time.Hour
+)
+
+// errIdempotencyKeyUsed is returned by CreateOrder when another request
+// stored the key first
+var errIdempotencyKeyUsed = errors.New("idempotency key already used")
+
+// IdempotencyRecord is the response to replay for an Idempotency-Key
+// until it expires
+type IdempotencyRecord struct {
+	Key string
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string
+	OrderID     string
+	StatusCode  int
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// requestFingerprint hashes the fields of an order request, after the
+// defaults are applied, so formatting differences do not count
+func requestFingerprint(req OrderRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayIdempotent writes the stored response of key and reports whether
+// it did, a key reused with a different request is rejected with 422
+func (os *OrderService) replayIdempotent(c *gin.Context, key, fingerprint string) bool {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	record, err := os.store.IdempotencyRecord(ctx, key, time.Now())
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		os.logger.Error("Failed to read idempotency key",
+			"error", err,
+			"trace_id", span.SpanContext().TraceID().String(),
+			"span_id", span.SpanContext().SpanID().String(),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read idempotency key"})
+		return true
+	}
+	if record == nil {
+		return false
+	}
+
+	if record.Fingerprint != fingerprint {
+		os.logger.Warn("Idempotency key reused with a different request",
+			"order_id", record.OrderID,
+			"trace_id", span.SpanContext().TraceID().String(),
+			"span_id", span.SpanContext().SpanID().String(),
+		)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": idempotencyKeyHeader + " was already used with a different request"})
+		return true
+	}
+
+	span.SetAttributes(attribute.Bool("idempotency.replayed", true))
+	os.logger.Info("Replaying response of idempotency key",
+		"order_id", record.OrderID,
+		"http_status", record.StatusCode,
+		"first_seen", record.CreatedAt.Format(time.RFC3339),
+		"trace_id", span.SpanContext().TraceID().String(),
+		"span_id", span.SpanContext().SpanID().String(),
+	)
+	c.Header(idempotencyReplayedHeader, "true")
+	c.Data(record.StatusCode, "application/json; charset=utf-8", record.Response)
+	return true
+}
+
+// IdempotencyRecord returns the record of key, nil when the key is
+// unknown or expired at now
+func (s *OrderStore) IdempotencyRecord(ctx context.Context, key string, now time.Time) (*IdempotencyRecord, error) {
+	return idempotencyRecord(ctx, s.db, key, now)
+}
+
+// PurgeIdempotencyKeys deletes the keys expired at now
+func (s *OrderStore) PurgeIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, sqlstore.FormatTime(now))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func idempotencyRecord(ctx context.Context, q queryer, key string, now time.Time) (*IdempotencyRecord, error) {
+	record := IdempotencyRecord{Key: key}
+	var createdAt, expiresAt string
+	err := q.QueryRowContext(ctx, `SELECT fingerprint, order_id, status_code, response, created_at, expires_at
+		FROM idempotency_keys WHERE key = ? AND expires_at > ?`, key, sqlstore.FormatTime(now)).
+		Scan(&record.Fingerprint, &record.OrderID, &record.StatusCode, &record.Response, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("idempotency key: created_at: %w", err)
+	}
+	if record.ExpiresAt, err = sqlstore.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("idempotency key: expires_at: %w", err)
+	}
+	return &record, nil
+}
+
+// insertIdempotencyKey stores the record, replacing an expired one, and
+// returns errIdempotencyKeyUsed while the key is still live
+func insertIdempotencyKey(ctx context.Context, tx *sql.Tx, record IdempotencyRecord) error {
+	existing, err := idempotencyRecord(ctx, tx, record.Key, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errIdempotencyKeyUsed
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO idempotency_keys
+		(key, fingerprint, order_id, status_code, response, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		record.Key, record.Fingerprint, record.OrderID, record.StatusCode, record.Response,
+		sqlstore.FormatTime(record.CreatedAt), sqlstore.FormatTime(record.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("insert idempotency key: %w", err)
+	}
+	return nil
+}
+
+// purgeIdempotencyKeys deletes expired keys every interval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, store *OrderStore, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := store.PurgeIdempotencyKeys(ctx, now)
+			if err != nil {
+				logger.Error("Failed to purge expired idempotency keys", "error", err)
+				continue
+			}
+			if purged > 0 {
+				logger.Info("Purged expired idempotency keys", "count", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func idempotencyHeader(key string) http.Header {
+	return http.Header{idempotencyKeyHeader: {key}}
+}
+
+func TestCreateOrderReplaysIdempotencyKey(t *testing.T) {
+	ts := newTestOrderService(t)
+
+	first := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1,"quantity":2}`, idempotencyHeader("key-1"))
+	// The same request formatted differently, the omitted defaults are the same
+	second := ts.serve("POST", "/order", `{"product_id": 1, "customer_id": 1, "quantity": 2}`, idempotencyHeader("key-1"))
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(idempotencyReplayedHeader))
+	assert.JSONEq(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, OrderResponse{OrderID: decodeOrderResponse(t, first.Body.Bytes()).OrderID, Status: OrderPending, TotalPrice: 200},
+		decodeOrderResponse(t, second.Body.Bytes()))
+
+	// The replay neither looks the product up nor stores an order
+	assert.Equal(t, int32(1), ts.productCalls.Load())
+	orders, err := ts.store.OrdersByCustomer(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Len(t, ts.pendingOutbox(t), 1)
+}
+
+func TestCreateOrderIdempotencyKeyProblems(t *testing.T) {
+	tests := []struct {
+		name       string
+		firstBody  string
+		secondBody string
+		key        string
+		wantStatus int
+	}{
+		{"different customer", `{"customer_id":1,"product_id":1}`, `{"customer_id":2,"product_id":1}`, "key-1", http.StatusUnprocessableEntity},
+		{"different quantity", `{"customer_id":1,"product_id":1}`, `{"customer_id":1,"product_id":1,"quantity":3}`, "key-1", http.StatusUnprocessableEntity},
+		{"key too long", `{"customer_id":1,"product_id":1}`, `{"customer_id":1,"product_id":1}`, string(make([]byte, maxIdempotencyKeyLength+1)), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestOrderService(t)
+			ts.serve("POST", "/order", tt.firstBody, idempotencyHeader("key-1"))
+
+			rr := ts.serve("POST", "/order", tt.secondBody, idempotencyHeader(tt.key))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Empty(t, rr.Header().Get(idempotencyReplayedHeader))
+			assert.Len(t, ts.pendingOutbox(t), 1)
+		})
+	}
+}
+
+func TestCreateOrderIdempotencyKeyOmittedQuantity(t *testing.T) {
+	ts := newTestOrderService(t)
+
+	first := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-1"))
+	second := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1,"quantity":1}`, idempotencyHeader("key-1"))
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "true", second.Header().Get(idempotencyReplayedHeader))
+}
+
+func TestCreateOrderIdempotencyKeyConcurrently(t *testing.T) {
+	ts := newTestOrderService(t)
+
+	const requests = 8
+	responses := make([]OrderResponse, requests)
+	codes := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := ts.serve("POST", "/order", `{"customer_id":1,"product_id":2}`, idempotencyHeader("key-1"))
+			codes[i] = rr.Code
+			responses[i] = decodeOrderResponse(t, rr.Body.Bytes())
+		}(i)
+	}
+	wg.Wait()
+
+	// Every request gets the response of the one that stored the key
+	for i := 0; i < requests; i++ {
+		assert.Equal(t, http.StatusCreated, codes[i])
+		assert.Equal(t, responses[0], responses[i])
+	}
+	orders, err := ts.store.OrdersByCustomer(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Len(t, ts.pendingOutbox(t), 1)
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	ts := newTestOrderService(t)
+	ts.idempotencyTTL = time.Millisecond
+	ctx := context.Background()
+
+	first := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-1"))
+	time.Sleep(5 * time.Millisecond)
+	second := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-1"))
+
+	// The expired key is used again for a new order
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Empty(t, second.Header().Get(idempotencyReplayedHeader))
+	assert.NotEqual(t, decodeOrderResponse(t, first.Body.Bytes()).OrderID, decodeOrderResponse(t, second.Body.Bytes()).OrderID)
+
+	// The key now replays the new order until it expires in turn
+	record, err := ts.store.IdempotencyRecord(ctx, "key-1", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, decodeOrderResponse(t, second.Body.Bytes()).OrderID, record.OrderID)
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	ts := newTestOrderService(t)
+	ctx := context.Background()
+
+	ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-1"))
+	ts.idempotencyTTL = 2 * time.Hour
+	ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-2"))
+
+	// Act, key-1 expires after an hour and key-2 after two
+	purged, err := ts.store.PurgeIdempotencyKeys(ctx, time.Now().Add(90*time.Minute))
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	var keys []string
+	rows, err := ts.store.db.QueryContext(ctx, `SELECT key FROM idempotency_keys`)
+	assert.NoError(t, err)
+	for rows.Next() {
+		var key string
+		assert.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"key-2"}, keys)
+
+	purged, err = ts.store.PurgeIdempotencyKeys(ctx, time.Now().Add(90*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+}
+
+func TestPurgeIdempotencyKeysRunsEveryInterval(t *testing.T) {
+	ts := newTestOrderService(t)
+	ts.idempotencyTTL = time.Millisecond
+	ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, idempotencyHeader("key-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		purgeIdempotencyKeys(ctx, ts.store, ts.logger, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		var count int
+		ts.store.db.QueryRow(`SELECT COUNT(*) FROM idempotency_keys`).Scan(&count)
+		return count == 0
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
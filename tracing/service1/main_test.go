@@ -0,0 +1,183 @@
+package main
+
+import (
+	"consumer1"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"model"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+// testProducts are served by the product service stub
+var testProducts = map[string]model.Product{
+	"/api/v1/products/1": {ID: 1, ProductName: "Product 1", Price: 100, Stock: 10, Version: 1},
+	"/api/v1/products/2": {ID: 2, ProductName: "Product 2", Price: 250, Stock: 5, Version: 1},
+	"/api/v1/products/3": {ID: 3, ProductName: "Product 3", Price: math.MaxInt / 2, Stock: 5, Version: 1},
+}
+
+// testOrderService is an OrderService over a temporary SQLite store and a
+// product service stub, routed as in main
+type testOrderService struct {
+	*OrderService
+	handler http.Handler
+	// productCalls counts the requests to the product service
+	productCalls atomic.Int32
+}
+
+func newTestOrderService(t *testing.T) *testOrderService {
+	store, err := OpenOrderStore(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	ts := &testOrderService{}
+	products := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ts.productCalls.Add(1)
+		product, ok := testProducts[req.URL.Path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(rw).Encode(product)
+	}))
+	t.Cleanup(products.Close)
+
+	client, err := consumer1.NewClient(products.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	ts.OrderService = &OrderService{
+		store:          store,
+		relay:          NewOutboxRelay(store, nil, logger),
+		products:       client,
+		tracer:         otel.Tracer("order-service"),
+		logger:         logger,
+		topic:          "orders",
+		idempotencyTTL: time.Hour,
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ts.registerRoutes(r)
+	ts.handler = r
+	return ts
+}
+
+// serve sends a request with the given headers to the order endpoints
+func (ts *testOrderService) serve(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rr := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// createOrder creates an order and returns its ID
+func (ts *testOrderService) createOrder(t *testing.T, body string) string {
+	rr := ts.serve("POST", "/order", body, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create order: %d %s", rr.Code, rr.Body)
+	}
+	return decodeOrderResponse(t, rr.Body.Bytes()).OrderID
+}
+
+// pendingOutbox returns the messages waiting in the outbox
+func (ts *testOrderService) pendingOutbox(t *testing.T) []OutboxMessage {
+	messages, err := ts.store.PendingOutbox(context.Background(), time.Now().Add(time.Minute), outboxBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func decodeOrderResponse(t *testing.T, body []byte) OrderResponse {
+	var response OrderResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestCreateOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantTotal  int
+	}{
+		{"total from product price", `{"customer_id":1,"product_id":2,"quantity":3}`, http.StatusCreated, 750},
+		{"quantity defaults to 1", `{"customer_id":1,"product_id":1}`, http.StatusCreated, 100},
+		{"unknown product", `{"customer_id":1,"product_id":9}`, http.StatusUnprocessableEntity, 0},
+		{"missing customer", `{"product_id":1}`, http.StatusBadRequest, 0},
+		{"negative quantity", `{"customer_id":1,"product_id":1,"quantity":-1}`, http.StatusBadRequest, 0},
+		{"quantity too large", `{"customer_id":1,"product_id":1,"quantity":1001}`, http.StatusBadRequest, 0},
+		{"total overflows", `{"customer_id":1,"product_id":3,"quantity":3}`, http.StatusBadRequest, 0},
+		{"price in the request is ignored", `{"customer_id":1,"product_id":1,"total_price":1}`, http.StatusCreated, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestOrderService(t)
+
+			rr := ts.serve("POST", "/order", tt.body, nil)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantStatus != http.StatusCreated {
+				assert.Empty(t, ts.pendingOutbox(t))
+				return
+			}
+			response := decodeOrderResponse(t, rr.Body.Bytes())
+			assert.Equal(t, OrderPending, response.Status)
+			assert.Equal(t, tt.wantTotal, response.TotalPrice)
+
+			// The order is stored with its OrderCreated event
+			order, err := ts.store.Order(context.Background(), response.OrderID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTotal, order.TotalPrice)
+			messages := ts.pendingOutbox(t)
+			assert.Len(t, messages, 1)
+			var event OrderCreatedEvent
+			if err := json.Unmarshal(messages[0].Payload, &event); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, response.OrderID, event.OrderID)
+			assert.Equal(t, tt.wantTotal, event.TotalPrice)
+			assert.Equal(t, EventOrderCreated, messages[0].Metadata["event_type"])
+		})
+	}
+}
+
+func TestCreateOrderProductServiceDown(t *testing.T) {
+	ts := newTestOrderService(t)
+	down := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	client, err := consumer1.NewClient(down.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.products = client
+
+	rr := ts.serve("POST", "/order", `{"customer_id":1,"product_id":1}`, nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Empty(t, ts.pendingOutbox(t))
+}
@@ -0,0 +1,26 @@
+CREATE TABLE orders (
+    id          TEXT PRIMARY KEY,
+    customer_id INTEGER NOT NULL,
+    product_id  INTEGER NOT NULL,
+    quantity    INTEGER NOT NULL,
+    total_price INTEGER NOT NULL,
+    status      TEXT NOT NULL,
+    created_at  TEXT NOT NULL
+);
+
+-- Events written in the same transaction as the orders they describe,
+-- published by the outbox relay
+CREATE TABLE outbox (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_uuid    TEXT NOT NULL UNIQUE,
+    topic           TEXT NOT NULL,
+    payload         BLOB NOT NULL,
+    metadata        TEXT NOT NULL,
+    created_at      TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TEXT NOT NULL,
+    sent_at         TEXT
+);
+
+CREATE INDEX outbox_pending ON outbox (next_attempt_at, id) WHERE sent_at IS NULL;
@@ -0,0 +1,12 @@
+-- Responses of POST /order kept for replay, by Idempotency-Key
+CREATE TABLE idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    order_id    TEXT NOT NULL REFERENCES orders (id),
+    status_code INTEGER NOT NULL,
+    response    BLOB NOT NULL,
+    created_at  TEXT NOT NULL,
+    expires_at  TEXT NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at);
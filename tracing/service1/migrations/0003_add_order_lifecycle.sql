@@ -0,0 +1,6 @@
+-- Orders start pending, the former created status is the same state
+ALTER TABLE orders ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+UPDATE orders SET updated_at = created_at;
+UPDATE orders SET status = 'pending' WHERE status = 'created';
+
+CREATE INDEX orders_customer_id ON orders (customer_id, created_at);
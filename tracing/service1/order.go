@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderConfirmed OrderStatus = "confirmed"
+	OrderPaid      OrderStatus = "paid"
+	OrderShipped   OrderStatus = "shipped"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// Event types published on the orders exchange, also sent as the
+// event_type message metadata
+const (
+	EventOrderCreated   = "OrderCreated"
+	EventOrderConfirmed = "OrderConfirmed"
+	EventOrderPaid      = "OrderPaid"
+	EventOrderShipped   = "OrderShipped"
+	EventOrderCancelled = "OrderCancelled"
+)
+
+var (
+	errOrderNotFound = errors.New("order not found")
+	// errInvalidTransition is returned for a transition the order status does not allow
+	errInvalidTransition = errors.New("invalid order transition")
+	// errOrderChanged is returned when the order changed status concurrently
+	errOrderChanged = errors.New("order changed concurrently")
+)
+
+// orderTransitions lists the statuses each status can move to, shipped
+// and cancelled orders are final
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:   {OrderConfirmed, OrderCancelled},
+	OrderConfirmed: {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderShipped, OrderCancelled},
+}
+
+// statusEvents is the event published when an order enters a status
+var statusEvents = map[OrderStatus]string{
+	OrderConfirmed: EventOrderConfirmed,
+	OrderPaid:      EventOrderPaid,
+	OrderShipped:   EventOrderShipped,
+	OrderCancelled: EventOrderCancelled,
+}
+
+// CanTransition reports whether an order in status s can move to next
+func (s OrderStatus) CanTransition(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Order is an order accepted by the service
+type Order struct {
+	ID         string      `json:"order_id"`
+	CustomerID int         `json:"customer_id"`
+	ProductID  int         `json:"product_id"`
+	Quantity   int         `json:"quantity"`
+	TotalPrice int         `json:"total_price"`
+	Status     OrderStatus `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Transition moves the order to next at the given time, or returns
+// errInvalidTransition when its status does not allow it
+func (o *Order) Transition(next OrderStatus, at time.Time) error {
+	if !o.Status.CanTransition(next) {
+		return fmt.Errorf("%w: order %s is %s and cannot become %s", errInvalidTransition, o.ID, o.Status, next)
+	}
+	o.Status = next
+	o.UpdatedAt = at
+	return nil
+}
+
+// OrderStatusChangedEvent is the payload of every event published when an
+// order changes status (OrderConfirmed, OrderPaid, OrderShipped, OrderCancelled)
+type OrderStatusChangedEvent struct {
+	OrderID        string      `json:"order_id"`
+	TotalPrice     int         `json:"total_price"`
+	CustomerID     int         `json:"customer_id"`
+	ProductID      int         `json:"product_id"`
+	Quantity       int         `json:"quantity"`
+	PreviousStatus OrderStatus `json:"previous_status"`
+	Status         OrderStatus `json:"status"`
+	ChangedAt      string      `json:"changed_at"`
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (os *OrderService) getOrder(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	order, err := os.store.Order(ctx, c.Param("id"))
+	if err != nil {
+		os.writeOrderError(c, err)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("order.id", order.ID),
+		attribute.String("order.status", string(order.Status)),
+	)
+	c.JSON(http.StatusOK, order)
+}
+
+func (os *OrderService) listOrders(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	customerID, err := strconv.Atoi(c.Query("customer_id"))
+	if err != nil || customerID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_id must be a positive integer"})
+		return
+	}
+
+	orders, err := os.store.OrdersByCustomer(ctx, customerID)
+	if err != nil {
+		os.writeOrderError(c, err)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int("order.customer_id", customerID),
+		attribute.Int("orders.count", len(orders)),
+	)
+	os.logger.Info("Orders retrieved",
+		"customer_id", customerID,
+		"total_orders", len(orders),
+		"trace_id", span.SpanContext().TraceID().String(),
+		"span_id", span.SpanContext().SpanID().String(),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"total":  len(orders),
+	})
+}
+
+// transitionHandler returns the handler moving the order in the path to next
+func (os *OrderService) transitionHandler(next OrderStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, err := os.transitionOrder(c.Request.Context(), c.Param("id"), next)
+		if err != nil {
+			os.writeOrderError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// transitionOrder moves an order to next and stores the event of the
+// transition in the outbox in the same transaction
+func (os *OrderService) transitionOrder(ctx context.Context, id string, next OrderStatus) (*Order, error) {
+	// Create a child span for the transition
+	ctx, span := os.tracer.Start(ctx, "transition_order")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	span.SetAttributes(
+		attribute.String("order.id", id),
+		attribute.String("order.next_status", string(next)),
+	)
+
+	order, err := os.store.Order(ctx, id)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		return nil, err
+	}
+
+	previous := order.Status
+	if err := order.Transition(next, time.Now().UTC()); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		os.logger.Warn("Order transition rejected",
+			"order_id", id,
+			"status", previous,
+			"next_status", next,
+			"trace_id", traceID,
+			"span_id", spanID,
+		)
+		return nil, err
+	}
+
+	eventType := statusEvents[next]
+	event := OrderStatusChangedEvent{
+		OrderID:        order.ID,
+		TotalPrice:     order.TotalPrice,
+		CustomerID:     order.CustomerID,
+		ProductID:      order.ProductID,
+		Quantity:       order.Quantity,
+		PreviousStatus: previous,
+		Status:         order.Status,
+		ChangedAt:      order.UpdatedAt.Format(time.RFC3339),
+	}
+	outboxMsg, err := os.newOutboxMessage(ctx, eventType, event, order.UpdatedAt)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		return nil, err
+	}
+
+	if err := os.store.UpdateOrderStatus(ctx, *order, previous, outboxMsg); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		return nil, err
+	}
+	os.relay.Notify()
+
+	span.SetAttributes(
+		attribute.String("message.id", outboxMsg.MessageUUID),
+		attribute.String("event.type", eventType),
+	)
+	os.logger.Info("Order status changed",
+		"order_id", order.ID,
+		"previous_status", previous,
+		"status", order.Status,
+		"event_type", eventType,
+		"message_id", outboxMsg.MessageUUID,
+		"trace_id", traceID,
+		"span_id", spanID,
+	)
+
+	return order, nil
+}
+
+// writeOrderError maps the order errors to HTTP responses
+func (os *OrderService) writeOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	case errors.Is(err, errInvalidTransition), errors.Is(err, errOrderChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		span := trace.SpanFromContext(c.Request.Context())
+		span.SetAttributes(attribute.String("error", err.Error()))
+		os.logger.Error("Failed to handle order request",
+			"error", err,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"trace_id", span.SpanContext().TraceID().String(),
+			"span_id", span.SpanContext().SpanID().String(),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle order request"})
+	}
+}
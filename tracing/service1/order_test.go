@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatusCanTransition(t *testing.T) {
+	statuses := []OrderStatus{OrderPending, OrderConfirmed, OrderPaid, OrderShipped, OrderCancelled}
+	allowed := map[[2]OrderStatus]bool{
+		{OrderPending, OrderConfirmed}:   true,
+		{OrderPending, OrderCancelled}:   true,
+		{OrderConfirmed, OrderPaid}:      true,
+		{OrderConfirmed, OrderCancelled}: true,
+		{OrderPaid, OrderShipped}:        true,
+		{OrderPaid, OrderCancelled}:      true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			assert.Equal(t, allowed[[2]OrderStatus{from, to}], from.CanTransition(to), "%s to %s", from, to)
+		}
+	}
+}
+
+func TestOrderTransition(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changedAt := createdAt.Add(time.Hour)
+	tests := []struct {
+		from, to   OrderStatus
+		wantErr    error
+		wantStatus OrderStatus
+		wantAt     time.Time
+	}{
+		{OrderPending, OrderConfirmed, nil, OrderConfirmed, changedAt},
+		{OrderPaid, OrderCancelled, nil, OrderCancelled, changedAt},
+		{OrderPending, OrderShipped, errInvalidTransition, OrderPending, createdAt},
+		{OrderShipped, OrderCancelled, errInvalidTransition, OrderShipped, createdAt},
+		{OrderCancelled, OrderPending, errInvalidTransition, OrderCancelled, createdAt},
+	}
+	for _, tt := range tests {
+		order := Order{ID: "order-1", Status: tt.from, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+		err := order.Transition(tt.to, changedAt)
+
+		if tt.wantErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, tt.wantErr)
+		}
+		assert.Equal(t, tt.wantStatus, order.Status, "%s to %s", tt.from, tt.to)
+		assert.Equal(t, tt.wantAt, order.UpdatedAt, "%s to %s", tt.from, tt.to)
+	}
+}
+
+func TestOrderLifecycleEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		actions    []string
+		wantCodes  []int
+		wantStatus OrderStatus
+		wantEvents []string
+	}{
+		{
+			name:       "shipped",
+			actions:    []string{"confirm", "pay", "ship"},
+			wantCodes:  []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			wantStatus: OrderShipped,
+			wantEvents: []string{EventOrderCreated, EventOrderConfirmed, EventOrderPaid, EventOrderShipped},
+		},
+		{
+			name:       "cancelled when pending",
+			actions:    []string{"cancel"},
+			wantCodes:  []int{http.StatusOK},
+			wantStatus: OrderCancelled,
+			wantEvents: []string{EventOrderCreated, EventOrderCancelled},
+		},
+		{
+			name:       "paid before confirmed",
+			actions:    []string{"pay"},
+			wantCodes:  []int{http.StatusConflict},
+			wantStatus: OrderPending,
+			wantEvents: []string{EventOrderCreated},
+		},
+		{
+			name:       "shipped when cancelled",
+			actions:    []string{"confirm", "cancel", "ship"},
+			wantCodes:  []int{http.StatusOK, http.StatusOK, http.StatusConflict},
+			wantStatus: OrderCancelled,
+			wantEvents: []string{EventOrderCreated, EventOrderConfirmed, EventOrderCancelled},
+		},
+		{
+			name:       "confirmed twice",
+			actions:    []string{"confirm", "confirm"},
+			wantCodes:  []int{http.StatusOK, http.StatusConflict},
+			wantStatus: OrderConfirmed,
+			wantEvents: []string{EventOrderCreated, EventOrderConfirmed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestOrderService(t)
+			id := ts.createOrder(t, `{"customer_id":1,"product_id":2,"quantity":2}`)
+
+			// Act
+			for i, action := range tt.actions {
+				rr := ts.serve("POST", "/order/"+id+"/"+action, "", nil)
+				assert.Equal(t, tt.wantCodes[i], rr.Code, action)
+			}
+
+			// Assert
+			rr := ts.serve("GET", "/order/"+id, "", nil)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var order Order
+			if err := json.Unmarshal(rr.Body.Bytes(), &order); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantStatus, order.Status)
+
+			var events []string
+			for _, msg := range ts.pendingOutbox(t) {
+				assert.Equal(t, "orders", msg.Topic)
+				events = append(events, msg.Metadata["event_type"])
+			}
+			assert.Equal(t, tt.wantEvents, events)
+		})
+	}
+}
+
+func TestOrderTransitionEvent(t *testing.T) {
+	ts := newTestOrderService(t)
+	id := ts.createOrder(t, `{"customer_id":7,"product_id":2,"quantity":2}`)
+
+	rr := ts.serve("POST", "/order/"+id+"/confirm", "", nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	messages := ts.pendingOutbox(t)
+	assert.Len(t, messages, 2)
+	var event OrderStatusChangedEvent
+	if err := json.Unmarshal(messages[1].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, EventOrderConfirmed, messages[1].Metadata["event_type"])
+	assert.Equal(t, OrderStatusChangedEvent{
+		OrderID:        id,
+		TotalPrice:     500,
+		CustomerID:     7,
+		ProductID:      2,
+		Quantity:       2,
+		PreviousStatus: OrderPending,
+		Status:         OrderConfirmed,
+		ChangedAt:      event.ChangedAt,
+	}, event)
+	_, err := time.Parse(time.RFC3339, event.ChangedAt)
+	assert.NoError(t, err)
+}
+
+func TestOrderTransitionProblems(t *testing.T) {
+	ts := newTestOrderService(t)
+
+	rr := ts.serve("POST", "/order/unknown/confirm", "", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = ts.serve("GET", "/order/unknown", "", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = ts.serve("GET", "/orders?customer_id=0", "", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUpdateOrderStatusChangedConcurrently(t *testing.T) {
+	ts := newTestOrderService(t)
+	ctx := context.Background()
+	id := ts.createOrder(t, `{"customer_id":1,"product_id":1}`)
+	order, err := ts.store.Order(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another request cancelled the order after it was read
+	cancelled := *order
+	assert.NoError(t, cancelled.Transition(OrderCancelled, time.Now().UTC()))
+	assert.NoError(t, ts.store.UpdateOrderStatus(ctx, cancelled, OrderPending))
+
+	confirmed := *order
+	assert.NoError(t, confirmed.Transition(OrderConfirmed, time.Now().UTC()))
+	err = ts.store.UpdateOrderStatus(ctx, confirmed, OrderPending, OutboxMessage{MessageUUID: "message-1", Topic: "orders", Payload: []byte(`{}`), CreatedAt: time.Now()})
+
+	assert.True(t, errors.Is(err, errOrderChanged))
+	stored, err := ts.store.Order(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, OrderCancelled, stored.Status)
+	// The event of the rejected transition is not stored
+	assert.Len(t, ts.pendingOutbox(t), 1)
+}
+
+func TestListOrders(t *testing.T) {
+	ts := newTestOrderService(t)
+	first := ts.createOrder(t, `{"customer_id":1,"product_id":1}`)
+	ts.createOrder(t, `{"customer_id":2,"product_id":1}`)
+	second := ts.createOrder(t, `{"customer_id":1,"product_id":2}`)
+
+	rr := ts.serve("GET", "/orders?customer_id=1", "", nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var body struct {
+		Orders []Order `json:"orders"`
+		Total  int     `json:"total"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, body.Total)
+	assert.Equal(t, first, body.Orders[0].ID)
+	assert.Equal(t, second, body.Orders[1].ID)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	outboxMinBackoff   = time.Second
+	outboxMaxBackoff   = 5 * time.Minute
+)
+
+// OutboxRelay publishes the outbox messages through the Watermill publisher
+// and marks them sent. A message is published at least once: a crash
+// between publishing and marking it sent publishes it again.
+type OutboxRelay struct {
+	store     *OrderStore
+	publisher message.Publisher
+	tracer    trace.Tracer
+	logger    *slog.Logger
+	wake      chan struct{}
+}
+
+func NewOutboxRelay(store *OrderStore, publisher message.Publisher, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		tracer:    otel.Tracer("order-service"),
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify makes the relay look for pending messages without waiting for
+// the next poll
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays pending messages until ctx is done
+func (r *OutboxRelay) Run(ctx context.Context) {
+	r.logger.Info("Outbox relay started", "poll_interval", outboxPollInterval.String(), "batch_size", outboxBatchSize)
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.relayPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+func (r *OutboxRelay) relayPending(ctx context.Context) {
+	messages, err := r.store.PendingOutbox(ctx, time.Now(), outboxBatchSize)
+	if err != nil {
+		r.logger.Error("Failed to read pending outbox messages", "error", err)
+		return
+	}
+
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		r.relay(ctx, msg)
+	}
+}
+
+func (r *OutboxRelay) relay(ctx context.Context, outboxMsg OutboxMessage) {
+	// Continue the trace of the request that stored the message
+	msgCtx := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(outboxMsg.Metadata))
+	msgCtx, span := r.tracer.Start(msgCtx, "relay_outbox_message")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	// The stored UUID is kept across retries so consumers can drop duplicates
+	msg := message.NewMessage(outboxMsg.MessageUUID, outboxMsg.Payload)
+	for key, value := range outboxMsg.Metadata {
+		msg.Metadata.Set(key, value)
+	}
+	otel.GetTextMapPropagator().Inject(msgCtx, propagation.MapCarrier(msg.Metadata))
+
+	span.SetAttributes(
+		attribute.String("message.id", msg.UUID),
+		attribute.String("exchange", outboxMsg.Topic),
+		attribute.Int("outbox.attempt", outboxMsg.Attempts+1),
+	)
+
+	// Record the outcome even when ctx is cancelled by a shutdown, so that a
+	// message published just before is not published again on restart
+	recordCtx := context.WithoutCancel(ctx)
+
+	if err := r.publisher.Publish(outboxMsg.Topic, msg); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		backoff := outboxBackoff(outboxMsg.Attempts + 1)
+		r.logger.Error("Failed to publish outbox message",
+			"error", err,
+			"message_id", msg.UUID,
+			"exchange", outboxMsg.Topic,
+			"attempt", outboxMsg.Attempts+1,
+			"retry_in", backoff.String(),
+			"trace_id", traceID,
+			"span_id", spanID,
+		)
+		if err := r.store.MarkOutboxFailed(recordCtx, outboxMsg.ID, err, time.Now().Add(backoff)); err != nil {
+			r.logger.Error("Failed to record outbox publish failure", "error", err, "message_id", msg.UUID)
+		}
+		return
+	}
+
+	if err := r.store.MarkOutboxSent(recordCtx, outboxMsg.ID, time.Now()); err != nil {
+		// The message is published again on the next poll
+		r.logger.Error("Failed to mark outbox message sent", "error", err, "message_id", msg.UUID)
+		return
+	}
+
+	r.logger.Info("Outbox message published",
+		"message_id", msg.UUID,
+		"exchange", outboxMsg.Topic,
+		"attempt", outboxMsg.Attempts+1,
+		"delay", time.Since(outboxMsg.CreatedAt).String(),
+		"trace_id", traceID,
+		"span_id", spanID,
+	)
+}
+
+// outboxBackoff doubles the wait before each retry, from outboxMinBackoff
+// up to outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxMinBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
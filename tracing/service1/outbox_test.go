@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPublisher records the published messages, or fails with err
+type testPublisher struct {
+	mu       sync.Mutex
+	err      error
+	messages []*message.Message
+	topics   []string
+}
+
+func (p *testPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	for _, msg := range messages {
+		p.topics = append(p.topics, topic)
+		p.messages = append(p.messages, msg)
+	}
+	return nil
+}
+
+func (p *testPublisher) Close() error {
+	return nil
+}
+
+func (p *testPublisher) published() []*message.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*message.Message(nil), p.messages...)
+}
+
+func TestOutboxRelayPublishesPendingMessages(t *testing.T) {
+	ts := newTestOrderService(t)
+	id := ts.createOrder(t, `{"customer_id":1,"product_id":1}`)
+	ts.serve("POST", "/order/"+id+"/confirm", "", nil)
+	stored := ts.pendingOutbox(t)
+	publisher := &testPublisher{}
+	relay := NewOutboxRelay(ts.store, publisher, ts.logger)
+
+	// Act
+	relay.relayPending(context.Background())
+
+	// Assert, the messages keep their stored UUID and metadata, in order
+	published := publisher.published()
+	assert.Len(t, published, 2)
+	for i, msg := range published {
+		assert.Equal(t, stored[i].MessageUUID, msg.UUID)
+		assert.Equal(t, stored[i].Payload, []byte(msg.Payload))
+		assert.Equal(t, stored[i].Metadata["event_type"], msg.Metadata.Get("event_type"))
+	}
+	assert.Equal(t, []string{"orders", "orders"}, publisher.topics)
+	assert.Empty(t, ts.pendingOutbox(t))
+
+	// The sent messages are not published again
+	relay.relayPending(context.Background())
+	assert.Len(t, publisher.published(), 2)
+}
+
+func TestOutboxRelayRetriesFailedMessages(t *testing.T) {
+	ts := newTestOrderService(t)
+	ts.createOrder(t, `{"customer_id":1,"product_id":1}`)
+	publisher := &testPublisher{err: errors.New("broker unreachable")}
+	relay := NewOutboxRelay(ts.store, publisher, ts.logger)
+
+	// Act
+	relay.relayPending(context.Background())
+
+	// Assert, the message waits for its backoff before the next attempt
+	due, err := ts.store.PendingOutbox(context.Background(), time.Now(), outboxBatchSize)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+	retried := ts.pendingOutbox(t)
+	assert.Len(t, retried, 1)
+	assert.Equal(t, 1, retried[0].Attempts)
+	assert.Equal(t, "broker unreachable", retried[0].LastError)
+
+	publisher.mu.Lock()
+	publisher.err = nil
+	publisher.mu.Unlock()
+	messages, err := ts.store.PendingOutbox(context.Background(), time.Now().Add(outboxMinBackoff), outboxBatchSize)
+	assert.NoError(t, err)
+	relay.relay(context.Background(), messages[0])
+	assert.Len(t, publisher.published(), 1)
+	assert.Equal(t, retried[0].MessageUUID, publisher.published()[0].UUID)
+	assert.Empty(t, ts.pendingOutbox(t))
+}
+
+func TestOutboxRelayRunStopsWithContext(t *testing.T) {
+	ts := newTestOrderService(t)
+	publisher := &testPublisher{}
+	relay := NewOutboxRelay(ts.store, publisher, ts.logger)
+	ts.relay = relay
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	// Notify publishes a new order without waiting for the poll
+	ts.createOrder(t, `{"customer_id":1,"product_id":1}`)
+	assert.Eventually(t, func() bool { return len(publisher.published()) == 1 }, outboxPollInterval/2, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("relay did not stop")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, outboxMinBackoff},
+		{2, 2 * outboxMinBackoff},
+		{4, 8 * outboxMinBackoff},
+		{9, 256 * outboxMinBackoff},
+		{10, outboxMaxBackoff},
+		{100, outboxMaxBackoff},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, outboxBackoff(tt.attempts), "attempt %d", tt.attempts)
+	}
+}
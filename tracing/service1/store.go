@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sqlstore"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go SQLite driver, no cgo needed
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// OutboxMessage is an event waiting in the outbox to be published
+type OutboxMessage struct {
+	ID          int64
+	MessageUUID string
+	Topic       string
+	Payload     []byte
+	Metadata    map[string]string
+	CreatedAt   time.Time
+	Attempts    int
+	LastError   string
+}
+
+// OrderStore persists orders and their outbox in SQLite
+type OrderStore struct {
+	db *sql.DB
+}
+
+// OpenOrderStore opens (or creates) the SQLite database at path and
+// applies any pending schema migrations
+func OpenOrderStore(path string) (*OrderStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := sqlstore.Migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &OrderStore{db: db}, nil
+}
+
+func (s *OrderStore) Close() error {
+	return s.db.Close()
+}
+
+// CreateOrder stores the order together with its outbox messages in one
+// transaction, so an order is never stored without its events or the reverse.
+// A non-nil record stores the idempotency key of the request with them.
+func (s *OrderStore) CreateOrder(ctx context.Context, order Order, record *IdempotencyRecord, messages ...OutboxMessage) error {
+	// The transaction takes the write lock up front (_txlock=immediate),
+	// so two requests with the same idempotency key cannot both store it
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO orders (`+orderColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, order.CustomerID, order.ProductID, order.Quantity, order.TotalPrice, order.Status,
+		sqlstore.FormatTime(order.CreatedAt), sqlstore.FormatTime(order.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("insert order %s: %w", order.ID, err)
+	}
+
+	if record != nil {
+		if err := insertIdempotencyKey(ctx, tx, *record); err != nil {
+			return err
+		}
+	}
+
+	for _, msg := range messages {
+		if err := insertOutbox(ctx, tx, msg); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Order finds an order by its ID
+func (s *OrderStore) Order(ctx context.Context, id string) (*Order, error) {
+	order, err := scanOrder(s.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("order %s: %w", id, errOrderNotFound)
+	}
+	return order, err
+}
+
+// OrdersByCustomer returns the orders of a customer, oldest first
+func (s *OrderStore) OrdersByCustomer(ctx context.Context, customerID int) ([]Order, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE customer_id = ? ORDER BY created_at, id`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders, rows.Err()
+}
+
+// UpdateOrderStatus stores the new status of an order together with its
+// outbox messages, or returns errOrderChanged when the order is no longer
+// in the previous status
+func (s *OrderStore) UpdateOrderStatus(ctx context.Context, order Order, previous OrderStatus, messages ...OutboxMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		order.Status, sqlstore.FormatTime(order.UpdatedAt), order.ID, previous)
+	if err != nil {
+		return fmt.Errorf("update order %s: %w", order.ID, err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("order %s is no longer %s: %w", order.ID, previous, errOrderChanged)
+	}
+
+	for _, msg := range messages {
+		if err := insertOutbox(ctx, tx, msg); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// orderColumns are the columns read by scanOrder
+const orderColumns = `id, customer_id, product_id, quantity, total_price, status, created_at, updated_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(row scanner) (*Order, error) {
+	var order Order
+	var createdAt, updatedAt string
+	err := row.Scan(&order.ID, &order.CustomerID, &order.ProductID, &order.Quantity, &order.TotalPrice, &order.Status, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if order.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("order %s: created_at: %w", order.ID, err)
+	}
+	if order.UpdatedAt, err = sqlstore.ParseTime(updatedAt); err != nil {
+		return nil, fmt.Errorf("order %s: updated_at: %w", order.ID, err)
+	}
+	return &order, nil
+}
+
+func insertOutbox(ctx context.Context, tx *sql.Tx, msg OutboxMessage) error {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return err
+	}
+	createdAt := sqlstore.FormatTime(msg.CreatedAt)
+	_, err = tx.ExecContext(ctx, `INSERT INTO outbox (message_uuid, topic, payload, metadata, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.MessageUUID, msg.Topic, msg.Payload, string(metadata), createdAt, createdAt)
+	if err != nil {
+		return fmt.Errorf("insert outbox message %s: %w", msg.MessageUUID, err)
+	}
+	return nil
+}
+
+// PendingOutbox returns up to limit unsent messages due at now, oldest first
+func (s *OrderStore) PendingOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, message_uuid, topic, payload, metadata, created_at, attempts, last_error
+		FROM outbox WHERE sent_at IS NULL AND next_attempt_at <= ? ORDER BY id LIMIT ?`,
+		sqlstore.FormatTime(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var metadata, createdAt string
+		if err := rows.Scan(&msg.ID, &msg.MessageUUID, &msg.Topic, &msg.Payload, &metadata, &createdAt, &msg.Attempts, &msg.LastError); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(metadata), &msg.Metadata); err != nil {
+			return nil, fmt.Errorf("outbox message %d: metadata: %w", msg.ID, err)
+		}
+		if msg.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("outbox message %d: created_at: %w", msg.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkOutboxSent records that a message has been published
+func (s *OrderStore) MarkOutboxSent(ctx context.Context, id int64, sentAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = '', sent_at = ? WHERE id = ?`,
+		sqlstore.FormatTime(sentAt), id)
+	return err
+}
+
+// MarkOutboxFailed records a failed publication, the message is retried
+// from nextAttempt
+func (s *OrderStore) MarkOutboxFailed(ctx context.Context, id int64, cause error, nextAttempt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+		cause.Error(), sqlstore.FormatTime(nextAttempt), id)
+	return err
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sqlstore"
+	"strings"
+	"time"
+)
+
+var errNoOrders = errors.New("no orders")
+
+// bucketSizes are the granularities of the revenue buckets, the buckets
+// start at UTC hour and day boundaries
+var bucketSizes = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// Totals sums the orders of a report aggregate
+type Totals struct {
+	OrderCount        int     `json:"order_count"`
+	Revenue           int     `json:"revenue"`
+	AverageOrderValue float64 `json:"average_order_value"`
+}
+
+func newTotals(orderCount, revenue int) Totals {
+	totals := Totals{OrderCount: orderCount, Revenue: revenue}
+	if orderCount > 0 {
+		totals.AverageOrderValue = float64(revenue) / float64(orderCount)
+	}
+	return totals
+}
+
+// CustomerTotals are the totals of the orders of a customer
+type CustomerTotals struct {
+	CustomerID int `json:"customer_id"`
+	Totals
+	FirstOrderAt time.Time `json:"first_order_at"`
+	LastOrderAt  time.Time `json:"last_order_at"`
+}
+
+// ProductTotals are the totals of the orders of a product
+type ProductTotals struct {
+	ProductID int `json:"product_id"`
+	Totals
+	FirstOrderAt time.Time `json:"first_order_at"`
+	LastOrderAt  time.Time `json:"last_order_at"`
+}
+
+// RevenueBucket are the totals of the orders created in [Start, Start+size)
+type RevenueBucket struct {
+	Start time.Time `json:"start"`
+	Totals
+}
+
+// reportTables names the tables of a report projection, the live one or
+// the one being rebuilt
+type reportTables struct {
+	reports        string
+	customerTotals string
+	productTotals  string
+	revenueBuckets string
+}
+
+var (
+	liveTables = reportTables{
+		reports:        "reports",
+		customerTotals: "customer_totals",
+		productTotals:  "product_totals",
+		revenueBuckets: "revenue_buckets",
+	}
+	rebuildTables = reportTables{
+		reports:        "rebuild_reports",
+		customerTotals: "rebuild_customer_totals",
+		productTotals:  "rebuild_product_totals",
+		revenueBuckets: "rebuild_revenue_buckets",
+	}
+)
+
+// create returns the statements creating the tables as migrations/reports
+// creates the live ones, without the indexes of the reports
+func (t reportTables) create() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		order_id     TEXT PRIMARY KEY,
+		total_price  INTEGER NOT NULL,
+		customer_id  INTEGER NOT NULL,
+		product_id   INTEGER NOT NULL,
+		created_at   TEXT NOT NULL,
+		processed_at TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS %s (
+		customer_id    INTEGER PRIMARY KEY,
+		order_count    INTEGER NOT NULL,
+		revenue        INTEGER NOT NULL,
+		first_order_at TEXT NOT NULL,
+		last_order_at  TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS %s (
+		product_id     INTEGER PRIMARY KEY,
+		order_count    INTEGER NOT NULL,
+		revenue        INTEGER NOT NULL,
+		first_order_at TEXT NOT NULL,
+		last_order_at  TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS %s (
+		granularity  TEXT NOT NULL,
+		bucket_start TEXT NOT NULL,
+		order_count  INTEGER NOT NULL,
+		revenue      INTEGER NOT NULL,
+		PRIMARY KEY (granularity, bucket_start)
+	)`, t.reports, t.customerTotals, t.productTotals, t.revenueBuckets)
+}
+
+// drop returns the statements dropping the tables
+func (t reportTables) drop() string {
+	return fmt.Sprintf(`DROP TABLE IF EXISTS %s; DROP TABLE IF EXISTS %s; DROP TABLE IF EXISTS %s; DROP TABLE IF EXISTS %s`,
+		t.reports, t.customerTotals, t.productTotals, t.revenueBuckets)
+}
+
+// addToAggregates adds a newly stored report to the aggregates of tables,
+// in the transaction storing it so that a report is counted exactly once
+func addToAggregates(ctx context.Context, tx *sql.Tx, tables reportTables, report OrderReport) error {
+	createdAt := sqlstore.FormatTime(report.CreatedAt)
+
+	for _, table := range []struct {
+		name, column string
+		id           int
+	}{
+		{tables.customerTotals, "customer_id", report.CustomerID},
+		{tables.productTotals, "product_id", report.ProductID},
+	} {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, order_count, revenue, first_order_at, last_order_at)
+			VALUES (?, 1, ?, ?, ?)
+			ON CONFLICT (%[2]s) DO UPDATE SET
+				order_count = order_count + 1,
+				revenue = revenue + excluded.revenue,
+				first_order_at = MIN(first_order_at, excluded.first_order_at),
+				last_order_at = MAX(last_order_at, excluded.last_order_at)`, table.name, table.column),
+			table.id, report.TotalPrice, createdAt, createdAt)
+		if err != nil {
+			return fmt.Errorf("update %s: %w", table.name, err)
+		}
+	}
+
+	for granularity, size := range bucketSizes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO `+tables.revenueBuckets+` (granularity, bucket_start, order_count, revenue)
+			VALUES (?, ?, 1, ?)
+			ON CONFLICT (granularity, bucket_start) DO UPDATE SET
+				order_count = order_count + 1,
+				revenue = revenue + excluded.revenue`,
+			granularity, sqlstore.FormatTime(report.CreatedAt.Truncate(size)), report.TotalPrice)
+		if err != nil {
+			return fmt.Errorf("update %s revenue bucket: %w", granularity, err)
+		}
+	}
+
+	return nil
+}
+
+// Totals sums all the orders
+func (s *ReportStore) Totals(ctx context.Context) (Totals, error) {
+	var orderCount, revenue int
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(order_count), 0), COALESCE(SUM(revenue), 0) FROM customer_totals`).
+		Scan(&orderCount, &revenue)
+	if err != nil {
+		return Totals{}, err
+	}
+	return newTotals(orderCount, revenue), nil
+}
+
+// CustomerTotals returns the totals of a customer, or errNoOrders when
+// the customer has none
+func (s *ReportStore) CustomerTotals(ctx context.Context, customerID int) (*CustomerTotals, error) {
+	totals := CustomerTotals{CustomerID: customerID}
+	var err error
+	totals.Totals, totals.FirstOrderAt, totals.LastOrderAt, err = s.totalsBy(ctx, "customer_totals", "customer_id", customerID)
+	if err != nil {
+		return nil, fmt.Errorf("customer %d: %w", customerID, err)
+	}
+	return &totals, nil
+}
+
+// ProductTotals returns the totals of a product, or errNoOrders when the
+// product has none
+func (s *ReportStore) ProductTotals(ctx context.Context, productID int) (*ProductTotals, error) {
+	totals := ProductTotals{ProductID: productID}
+	var err error
+	totals.Totals, totals.FirstOrderAt, totals.LastOrderAt, err = s.totalsBy(ctx, "product_totals", "product_id", productID)
+	if err != nil {
+		return nil, fmt.Errorf("product %d: %w", productID, err)
+	}
+	return &totals, nil
+}
+
+func (s *ReportStore) totalsBy(ctx context.Context, table, column string, id int) (Totals, time.Time, time.Time, error) {
+	var orderCount, revenue int
+	var firstOrderAt, lastOrderAt string
+	err := s.db.QueryRowContext(ctx, `SELECT order_count, revenue, first_order_at, last_order_at FROM `+table+` WHERE `+column+` = ?`, id).
+		Scan(&orderCount, &revenue, &firstOrderAt, &lastOrderAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Totals{}, time.Time{}, time.Time{}, errNoOrders
+	}
+	if err != nil {
+		return Totals{}, time.Time{}, time.Time{}, err
+	}
+	first, err := sqlstore.ParseTime(firstOrderAt)
+	if err != nil {
+		return Totals{}, time.Time{}, time.Time{}, fmt.Errorf("first_order_at: %w", err)
+	}
+	last, err := sqlstore.ParseTime(lastOrderAt)
+	if err != nil {
+		return Totals{}, time.Time{}, time.Time{}, fmt.Errorf("last_order_at: %w", err)
+	}
+	return newTotals(orderCount, revenue), first, last, nil
+}
+
+// RevenueBuckets returns the buckets of a granularity starting in
+// [from, to), oldest first. Zero times do not bound the range.
+func (s *ReportStore) RevenueBuckets(ctx context.Context, granularity string, from, to time.Time) ([]RevenueBucket, error) {
+	conditions := []string{"granularity = ?"}
+	args := []any{granularity}
+	if !from.IsZero() {
+		conditions = append(conditions, "bucket_start >= ?")
+		args = append(args, sqlstore.FormatTime(from))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "bucket_start < ?")
+		args = append(args, sqlstore.FormatTime(to))
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT bucket_start, order_count, revenue FROM revenue_buckets
+		WHERE `+strings.Join(conditions, " AND ")+` ORDER BY bucket_start`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []RevenueBucket{}
+	for rows.Next() {
+		var start string
+		var orderCount, revenue int
+		if err := rows.Scan(&start, &orderCount, &revenue); err != nil {
+			return nil, err
+		}
+		bucket := RevenueBucket{Totals: newTotals(orderCount, revenue)}
+		if bucket.Start, err = sqlstore.ParseTime(start); err != nil {
+			return nil, fmt.Errorf("%s revenue bucket: bucket_start: %w", granularity, err)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type summaryResponse struct {
+	Totals      Totals          `json:"totals"`
+	Granularity string          `json:"granularity"`
+	Buckets     []RevenueBucket `json:"buckets"`
+}
+
+func bucketAt(day, hour, orderCount, revenue int) RevenueBucket {
+	return RevenueBucket{
+		Start:  time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC),
+		Totals: newTotals(orderCount, revenue),
+	}
+}
+
+func TestGetSummary(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	tests := []struct {
+		name        string
+		query       string
+		granularity string
+		want        []RevenueBucket
+	}{
+		{"days by default", "", "day", []RevenueBucket{bucketAt(1, 0, 3, 650), bucketAt(2, 0, 1, 50)}},
+		{"hours", "?granularity=hour", "hour", []RevenueBucket{bucketAt(1, 10, 2, 400), bucketAt(1, 11, 1, 250), bucketAt(2, 9, 1, 50)}},
+		{"from is inclusive", "?granularity=hour&from=2024-01-01T11:00:00Z", "hour", []RevenueBucket{bucketAt(1, 11, 1, 250), bucketAt(2, 9, 1, 50)}},
+		{"to is exclusive", "?granularity=hour&to=2024-01-01T11:00:00Z", "hour", []RevenueBucket{bucketAt(1, 10, 2, 400)}},
+		{"empty range", "?from=2025-01-01T00:00:00Z", "day", []RevenueBucket{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.serve("GET", "/reports/summary"+tt.query)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			got := decodeJSON[summaryResponse](t, rr.Body.Bytes())
+			// The buckets do not change the totals of all the orders
+			assert.Equal(t, Totals{OrderCount: 4, Revenue: 700, AverageOrderValue: 175}, got.Totals)
+			assert.Equal(t, tt.granularity, got.Granularity)
+			assert.Equal(t, tt.want, got.Buckets)
+		})
+	}
+}
+
+func TestGetTotals(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+	first := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	customer := decodeJSON[CustomerTotals](t, ts.serve("GET", "/reports/customers/2").Body.Bytes())
+	assert.Equal(t, CustomerTotals{
+		CustomerID:   2,
+		Totals:       Totals{OrderCount: 2, Revenue: 350, AverageOrderValue: 175},
+		FirstOrderAt: first,
+		LastOrderAt:  time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+	}, customer)
+
+	product := decodeJSON[ProductTotals](t, ts.serve("GET", "/reports/products/2").Body.Bytes())
+	assert.Equal(t, ProductTotals{
+		ProductID:    2,
+		Totals:       Totals{OrderCount: 2, Revenue: 550, AverageOrderValue: 275},
+		FirstOrderAt: first,
+		LastOrderAt:  time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC),
+	}, product)
+}
+
+func TestAggregatesCountEachOrderOnce(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	// Act, order-1 is published again under another message UUID
+	ts.consume(t, "message-9", testOrders[0])
+
+	// Assert
+	got := decodeJSON[summaryResponse](t, ts.serve("GET", "/reports/summary").Body.Bytes())
+	assert.Equal(t, Totals{OrderCount: 4, Revenue: 700, AverageOrderValue: 175}, got.Totals)
+	assert.Equal(t, []RevenueBucket{bucketAt(1, 0, 3, 650), bucketAt(2, 0, 1, 50)}, got.Buckets)
+	customer := decodeJSON[CustomerTotals](t, ts.serve("GET", "/reports/customers/1").Body.Bytes())
+	assert.Equal(t, 2, customer.OrderCount)
+}
+
+func TestGetSummaryWithoutOrders(t *testing.T) {
+	ts := newTestReportService(t)
+
+	rr := ts.serve("GET", "/reports/summary")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	got := decodeJSON[summaryResponse](t, rr.Body.Bytes())
+	assert.Equal(t, Totals{}, got.Totals)
+	assert.Equal(t, []RevenueBucket{}, got.Buckets)
+}
+
+func TestGetAggregatesProblems(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"unknown granularity", "/reports/summary?granularity=week", http.StatusBadRequest},
+		{"from is not RFC 3339", "/reports/summary?from=2024-01-01", http.StatusBadRequest},
+		{"to is not RFC 3339", "/reports/summary?to=tomorrow", http.StatusBadRequest},
+		{"customer without orders", "/reports/customers/3", http.StatusNotFound},
+		{"customer is not a number", "/reports/customers/one", http.StatusBadRequest},
+		{"customer is zero", "/reports/customers/0", http.StatusBadRequest},
+		{"product without orders", "/reports/products/3", http.StatusNotFound},
+		{"product is negative", "/reports/products/-2", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.serve("GET", tt.path)
+
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
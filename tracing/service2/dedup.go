@@ -0,0 +1,181 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"sqlstore"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go SQLite driver, no cgo needed
+)
+
+// DedupStore remembers the keys of processed messages so that redelivered
+// messages are skipped. Keys are forgotten after a TTL.
+type DedupStore interface {
+	// Seen returns the first of keys processed within the TTL, or "" when
+	// none was
+	Seen(ctx context.Context, keys ...string) (string, error)
+	// Mark records keys as processed now
+	Mark(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// messageKey and orderKey are the dedup keys of a message, a redelivery
+// has the same message UUID and a republished event the same order ID
+func messageKey(uuid string) string {
+	return "message:" + uuid
+}
+
+func orderKey(orderID string) string {
+	return "order:" + orderID
+}
+
+// MemoryDedupStore keeps at most maxEntries keys in memory, evicting the
+// oldest first
+type MemoryDedupStore struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key    string
+	markAt time.Time
+}
+
+func NewMemoryDedupStore(ttl time.Duration, maxEntries int) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryDedupStore) Seen(ctx context.Context, keys ...string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	for _, key := range keys {
+		if _, ok := s.entries[key]; ok {
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *MemoryDedupStore) Mark(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if elem, ok := s.entries[key]; ok {
+			s.order.Remove(elem)
+		}
+		s.entries[key] = s.order.PushBack(&dedupEntry{key: key, markAt: now})
+	}
+	for s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+		s.remove(s.order.Front())
+	}
+	return nil
+}
+
+func (s *MemoryDedupStore) Close() error {
+	return nil
+}
+
+// Len returns the number of remembered keys
+func (s *MemoryDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// expire removes the keys older than the TTL, the list is ordered by
+// mark time so it stops at the first live one
+func (s *MemoryDedupStore) expire(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if now.Sub(elem.Value.(*dedupEntry).markAt) < s.ttl {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+func (s *MemoryDedupStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*dedupEntry).key)
+}
+
+// SQLiteDedupStore keeps the keys in SQLite so that they survive restarts
+type SQLiteDedupStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// OpenSQLiteDedupStore opens (or creates) the dedup database at path and
+// applies any pending schema migrations
+func OpenSQLiteDedupStore(path string, ttl time.Duration) (*SQLiteDedupStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, "dedup"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteDedupStore{db: db, ttl: ttl}, nil
+}
+
+func (s *SQLiteDedupStore) Seen(ctx context.Context, keys ...string) (string, error) {
+	cutoff := sqlstore.FormatTime(time.Now().Add(-s.ttl))
+	for _, key := range keys {
+		var found int
+		err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM processed_messages WHERE key = ? AND marked_at > ?`, key, cutoff).Scan(&found)
+		if err != nil {
+			return "", err
+		}
+		if found > 0 {
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+// Mark records the keys and deletes the expired ones in the same
+// transaction, which keeps the table bounded by the TTL
+func (s *SQLiteDedupStore) Mark(ctx context.Context, keys ...string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, key := range keys {
+		_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO processed_messages (key, marked_at) VALUES (?, ?)`, key, sqlstore.FormatTime(now))
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM processed_messages WHERE marked_at <= ?`, sqlstore.FormatTime(now.Add(-s.ttl))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteDedupStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDedupMaxEntries is more keys than a test marks
+const testDedupMaxEntries = 1000
+
+// newDedupStoreFunc creates an empty dedup store forgetting keys after ttl
+type newDedupStoreFunc func(t *testing.T, ttl time.Duration) DedupStore
+
+// dedupStores lists every DedupStore implementation the tests run against
+var dedupStores = map[string]newDedupStoreFunc{
+	"memory": func(t *testing.T, ttl time.Duration) DedupStore {
+		return NewMemoryDedupStore(ttl, testDedupMaxEntries)
+	},
+	"sqlite": func(t *testing.T, ttl time.Duration) DedupStore {
+		store, err := OpenSQLiteDedupStore(filepath.Join(t.TempDir(), "dedup.db"), ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	},
+}
+
+func forEachDedupStore(t *testing.T, test func(t *testing.T, newStore newDedupStoreFunc)) {
+	for name, newStore := range dedupStores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			test(t, newStore)
+		})
+	}
+}
+
+func TestDedupStoreSeen(t *testing.T) {
+	forEachDedupStore(t, func(t *testing.T, newStore newDedupStoreFunc) {
+		store := newStore(t, time.Hour)
+		ctx := context.Background()
+		assert.NoError(t, store.Mark(ctx, messageKey("message-1"), orderKey("order-1")))
+
+		tests := []struct {
+			name string
+			keys []string
+			want string
+		}{
+			{"redelivered message", []string{messageKey("message-1"), orderKey("order-2")}, messageKey("message-1")},
+			{"republished order", []string{messageKey("message-2"), orderKey("order-1")}, orderKey("order-1")},
+			{"both keys seen", []string{messageKey("message-1"), orderKey("order-1")}, messageKey("message-1")},
+			{"new message", []string{messageKey("message-2"), orderKey("order-2")}, ""},
+			// The prefixes keep a message UUID and an order ID apart
+			{"order ID as message UUID", []string{messageKey("order-1")}, ""},
+		}
+		for _, tt := range tests {
+			seen, err := store.Seen(ctx, tt.keys...)
+
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.want, seen, tt.name)
+		}
+	})
+}
+
+func TestDedupStoreExpires(t *testing.T) {
+	forEachDedupStore(t, func(t *testing.T, newStore newDedupStoreFunc) {
+		store := newStore(t, 200*time.Millisecond)
+		ctx := context.Background()
+		assert.NoError(t, store.Mark(ctx, messageKey("message-1")))
+		time.Sleep(120 * time.Millisecond)
+		assert.NoError(t, store.Mark(ctx, messageKey("message-2")))
+
+		// Act, message-1 expires first
+		time.Sleep(120 * time.Millisecond)
+		first, err := store.Seen(ctx, messageKey("message-1"))
+		assert.NoError(t, err)
+		second, err := store.Seen(ctx, messageKey("message-2"))
+		assert.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, "", first)
+		assert.Equal(t, messageKey("message-2"), second)
+
+		// Marking a key again renews it
+		assert.NoError(t, store.Mark(ctx, messageKey("message-2")))
+		time.Sleep(120 * time.Millisecond)
+		second, err = store.Seen(ctx, messageKey("message-2"))
+		assert.NoError(t, err)
+		assert.Equal(t, messageKey("message-2"), second)
+	})
+}
+
+func TestMemoryDedupStoreEvictsOldest(t *testing.T) {
+	store := NewMemoryDedupStore(time.Hour, 3)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, store.Mark(ctx, messageKey(fmt.Sprint(i))))
+	}
+	// Marking 1 again makes 2 the oldest
+	assert.NoError(t, store.Mark(ctx, messageKey("1")))
+	assert.NoError(t, store.Mark(ctx, messageKey("4"), messageKey("5")))
+
+	assert.Equal(t, 3, store.Len())
+	for key, want := range map[string]bool{"1": true, "2": false, "3": false, "4": true, "5": true} {
+		seen, err := store.Seen(ctx, messageKey(key))
+		assert.NoError(t, err)
+		assert.Equal(t, want, seen != "", "key %s", key)
+	}
+}
+
+func TestSQLiteDedupStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	ctx := context.Background()
+
+	store, err := OpenSQLiteDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.Mark(ctx, messageKey("message-1"), orderKey("order-1")))
+	assert.NoError(t, store.Close())
+
+	store, err = OpenSQLiteDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	seen, err := store.Seen(ctx, messageKey("message-2"), orderKey("order-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, orderKey("order-1"), seen)
+}
+
+func TestSQLiteDedupStoreDeletesExpiredKeys(t *testing.T) {
+	store, err := OpenSQLiteDedupStore(filepath.Join(t.TempDir(), "dedup.db"), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	assert.NoError(t, store.Mark(ctx, messageKey("message-1"), messageKey("message-2")))
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, store.Mark(ctx, messageKey("message-3")))
+
+	var keys int
+	assert.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM processed_messages`).Scan(&keys))
+	assert.Equal(t, 1, keys)
+}
+
+func TestHandleOrderCreatedSkipsDuplicates(t *testing.T) {
+	ts := newTestReportService(t)
+	ctx := context.Background()
+	event := OrderCreatedEvent{OrderID: "order-1", TotalPrice: 100, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-01T10:00:00Z"}
+
+	// Act, a redelivery and a republished event of the same order
+	ts.consume(t, "message-1", event)
+	ts.consume(t, "message-1", event)
+	ts.consume(t, "message-2", event)
+
+	// Assert, the order is counted once and every event is logged once
+	reports, total, err := ts.store.Find(ctx, ReportQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "order-1", reports[0].OrderID)
+	totals, err := ts.store.Totals(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, newTotals(1, 100), totals)
+	logged, err := ts.store.CountEvents(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), logged)
+}
+
+func TestHandleOrderCreatedAfterDedupExpired(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.dedup = NewMemoryDedupStore(time.Millisecond, testDedupMaxEntries)
+	ctx := context.Background()
+	event := OrderCreatedEvent{OrderID: "order-1", TotalPrice: 100, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-01T10:00:00Z"}
+
+	ts.consume(t, "message-1", event)
+	time.Sleep(5 * time.Millisecond)
+	ts.consume(t, "message-2", event)
+
+	// The stored report still keeps the order from being counted twice
+	totals, err := ts.store.Totals(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, newTotals(1, 100), totals)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sqlstore"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errDeadLetterNotFound = errors.New("dead letter not found")
+	errAlreadyReplayed    = errors.New("dead letter already replayed")
+)
+
+// poisonedKeys are the metadata keys added by the poison queue middleware
+var poisonedKeys = []string{
+	middleware.ReasonForPoisonedKey,
+	middleware.PoisonedTopicKey,
+	middleware.PoisonedHandlerKey,
+	middleware.PoisonedSubscriberKey,
+}
+
+// DeadLetter is a message moved to the dead-letter queue after its
+// handler failed
+type DeadLetter struct {
+	ID          int64  `json:"id"`
+	MessageUUID string `json:"message_uuid"`
+	// Topic is the topic the message failed on, it is replayed there
+	Topic    string            `json:"topic"`
+	Handler  string            `json:"handler"`
+	Reason   string            `json:"reason"`
+	Payload  messagePayload    `json:"payload"`
+	Metadata map[string]string `json:"metadata"`
+	// DeadCount counts how many times the message was dead-lettered
+	DeadCount  int        `json:"dead_count"`
+	ReceivedAt time.Time  `json:"received_at"`
+	ReplayedAt *time.Time `json:"replayed_at,omitempty"`
+}
+
+// messagePayload is written as JSON when it is valid JSON and as a string
+// otherwise, so that an undecodable payload can still be listed
+type messagePayload []byte
+
+func (p messagePayload) MarshalJSON() ([]byte, error) {
+	if json.Valid(p) {
+		return p, nil
+	}
+	return json.Marshal(string(p))
+}
+
+// DeadLetterStore keeps the dead-lettered messages in SQLite until they
+// are replayed
+type DeadLetterStore struct {
+	db *sql.DB
+}
+
+// OpenDeadLetterStore opens (or creates) the dead letter database at path
+// and applies any pending schema migrations
+func OpenDeadLetterStore(path string) (*DeadLetterStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, "deadletters"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DeadLetterStore{db: db}, nil
+}
+
+func (s *DeadLetterStore) Close() error {
+	return s.db.Close()
+}
+
+// Add stores a dead letter, a message dead-lettered again after a replay
+// is pending again
+func (s *DeadLetterStore) Add(ctx context.Context, letter DeadLetter) error {
+	metadata, err := json.Marshal(letter.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO dead_letters (message_uuid, topic, handler, reason, payload, metadata, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (message_uuid) DO UPDATE SET
+			topic = excluded.topic, handler = excluded.handler, reason = excluded.reason,
+			metadata = excluded.metadata, received_at = excluded.received_at,
+			dead_count = dead_count + 1, replayed_at = NULL`,
+		letter.MessageUUID, letter.Topic, letter.Handler, letter.Reason, []byte(letter.Payload), string(metadata),
+		sqlstore.FormatTime(letter.ReceivedAt))
+	return err
+}
+
+// List returns the dead letters waiting for a replay, or all of them,
+// oldest first
+func (s *DeadLetterStore) List(ctx context.Context, includeReplayed bool) ([]DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letters`
+	if !includeReplayed {
+		query += ` WHERE replayed_at IS NULL`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, *letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// Get finds a dead letter by its ID
+func (s *DeadLetterStore) Get(ctx context.Context, id int64) (*DeadLetter, error) {
+	letter, err := scanDeadLetter(s.db.QueryRowContext(ctx, `SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("dead letter %d: %w", id, errDeadLetterNotFound)
+	}
+	return letter, err
+}
+
+// MarkReplayed records the replay of a dead letter, or returns
+// errAlreadyReplayed when another replay was recorded first
+func (s *DeadLetterStore) MarkReplayed(ctx context.Context, id int64, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE dead_letters SET replayed_at = ? WHERE id = ? AND replayed_at IS NULL`, sqlstore.FormatTime(at), id)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("dead letter %d: %w", id, errAlreadyReplayed)
+	}
+	return nil
+}
+
+// ClearReplayed makes a dead letter replayable again
+func (s *DeadLetterStore) ClearReplayed(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE dead_letters SET replayed_at = NULL WHERE id = ?`, id)
+	return err
+}
+
+// deadLetterColumns are the columns read by scanDeadLetter
+const deadLetterColumns = `id, message_uuid, topic, handler, reason, payload, metadata, dead_count, received_at, replayed_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeadLetter(row scanner) (*DeadLetter, error) {
+	var letter DeadLetter
+	var metadata string
+	var receivedAt string
+	var replayedAt sql.NullString
+	err := row.Scan(&letter.ID, &letter.MessageUUID, &letter.Topic, &letter.Handler, &letter.Reason,
+		&letter.Payload, &metadata, &letter.DeadCount, &receivedAt, &replayedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadata), &letter.Metadata); err != nil {
+		return nil, fmt.Errorf("dead letter %d: metadata: %w", letter.ID, err)
+	}
+	if letter.ReceivedAt, err = sqlstore.ParseTime(receivedAt); err != nil {
+		return nil, fmt.Errorf("dead letter %d: received_at: %w", letter.ID, err)
+	}
+	if replayedAt.Valid {
+		at, err := sqlstore.ParseTime(replayedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("dead letter %d: replayed_at: %w", letter.ID, err)
+		}
+		letter.ReplayedAt = &at
+	}
+	return &letter, nil
+}
+
+// DeadLetterService stores the messages of the dead-letter queue and
+// replays them on request
+type DeadLetterService struct {
+	store     *DeadLetterStore
+	publisher message.Publisher
+	// ordersTopic is replayed to when a dead letter does not name its topic
+	ordersTopic string
+	tracer      trace.Tracer
+	logger      *slog.Logger
+}
+
+// handleDeadLetter stores a message consumed from the dead-letter queue
+func (ds *DeadLetterService) handleDeadLetter(msg *message.Message) error {
+	ctx := msg.Context()
+	span := trace.SpanFromContext(ctx)
+	logger := messageLogger(ctx, ds.logger)
+
+	letter := DeadLetter{
+		MessageUUID: msg.UUID,
+		Topic:       msg.Metadata.Get(middleware.PoisonedTopicKey),
+		Handler:     msg.Metadata.Get(middleware.PoisonedHandlerKey),
+		Reason:      msg.Metadata.Get(middleware.ReasonForPoisonedKey),
+		Payload:     messagePayload(msg.Payload),
+		Metadata:    map[string]string{},
+		ReceivedAt:  time.Now().UTC(),
+	}
+	if letter.Topic == "" {
+		letter.Topic = ds.ordersTopic
+	}
+	for key, value := range msg.Metadata {
+		letter.Metadata[key] = value
+	}
+
+	span.SetAttributes(
+		attribute.String("dead_letter.topic", letter.Topic),
+		attribute.String("dead_letter.reason", letter.Reason),
+	)
+
+	if err := ds.store.Add(ctx, letter); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		logger.ErrorContext(ctx, "Failed to store dead letter", slog.String("error", err.Error()))
+		return err
+	}
+
+	logger.WarnContext(ctx, "Message moved to the dead-letter queue",
+		slog.String("original_topic", letter.Topic),
+		slog.String("failed_handler", letter.Handler),
+		slog.String("reason", letter.Reason),
+	)
+	return nil
+}
+
+func (ds *DeadLetterService) listDeadLetters(c *gin.Context) {
+	includeReplayed, _ := strconv.ParseBool(c.Query("all"))
+
+	letters, err := ds.store.List(c.Request.Context(), includeReplayed)
+	if err != nil {
+		ds.logger.Error("Failed to list dead letters", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": letters,
+		"total":    len(letters),
+	})
+}
+
+// replayDeadLetter publishes a dead letter again on the topic it failed
+// on, with its original UUID, payload and metadata
+func (ds *DeadLetterService) replayDeadLetter(c *gin.Context) {
+	ctx, span := ds.tracer.Start(c.Request.Context(), "replay_dead_letter")
+	defer span.End()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be an integer"})
+		return
+	}
+
+	letter, err := ds.store.Get(ctx, id)
+	if errors.Is(err, errDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	if err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		ds.logger.ErrorContext(ctx, "Failed to read dead letter", slog.String("error", err.Error()), slog.Int64("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead letter"})
+		return
+	}
+	if letter.ReplayedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Dead letter was already replayed at %s", letter.ReplayedAt.Format(time.RFC3339))})
+		return
+	}
+
+	// Claim the replay first so two requests cannot both publish it
+	replayedAt := time.Now().UTC()
+	if err := ds.store.MarkReplayed(ctx, id, replayedAt); err != nil {
+		if errors.Is(err, errAlreadyReplayed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Dead letter was already replayed"})
+			return
+		}
+		span.SetAttributes(attribute.String("error", err.Error()))
+		ds.logger.ErrorContext(ctx, "Failed to mark dead letter replayed", slog.String("error", err.Error()), slog.Int64("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letter"})
+		return
+	}
+
+	msg := message.NewMessage(letter.MessageUUID, []byte(letter.Payload))
+	for key, value := range letter.Metadata {
+		msg.Metadata.Set(key, value)
+	}
+	for _, key := range poisonedKeys {
+		delete(msg.Metadata, key)
+	}
+
+	span.SetAttributes(
+		attribute.String("message.id", msg.UUID),
+		attribute.String("topic", letter.Topic),
+	)
+
+	if err := ds.publisher.Publish(letter.Topic, msg); err != nil {
+		span.SetAttributes(attribute.String("error", err.Error()))
+		ds.logger.ErrorContext(ctx, "Failed to replay dead letter",
+			slog.String("error", err.Error()),
+			slog.Int64("id", id),
+			slog.String("message_id", msg.UUID),
+		)
+		// The message was not published, make it replayable again
+		if err := ds.store.ClearReplayed(ctx, id); err != nil {
+			ds.logger.ErrorContext(ctx, "Failed to restore dead letter", slog.String("error", err.Error()), slog.Int64("id", id))
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to publish dead letter"})
+		return
+	}
+
+	ds.logger.InfoContext(ctx, "Dead letter replayed",
+		slog.Int64("id", id),
+		slog.String("message_id", msg.UUID),
+		slog.String("topic", letter.Topic),
+	)
+
+	letter.ReplayedAt = &replayedAt
+	c.JSON(http.StatusOK, letter)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+
+	"config"
+)
+
+func TestRetryTransient(t *testing.T) {
+	errTransient := errors.New("database is locked")
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      error
+		wantPerm     bool
+	}{
+		{"success", []error{nil}, 1, nil, false},
+		{"transient then success", []error{errTransient, nil}, 2, nil, false},
+		{"transient every attempt", []error{errTransient, errTransient, errTransient, errTransient}, 4, errTransient, false},
+		{"permanent", []error{permanent(errTransient)}, 1, errTransient, true},
+		{"transient then permanent", []error{errTransient, permanent(errTransient)}, 2, errTransient, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry := middleware.Retry{MaxRetries: 3, InitialInterval: time.Millisecond}
+			attempts := 0
+			handler := retryTransient(retry)(func(msg *message.Message) ([]*message.Message, error) {
+				err := tt.errs[attempts]
+				attempts++
+				return nil, err
+			})
+
+			_, err := handler(message.NewMessage(watermill.NewUUID(), nil))
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantPerm, isPermanent(err))
+		})
+	}
+}
+
+func TestPoisonedMessagesAreDeadLettered(t *testing.T) {
+	ts := newTestReportService(t)
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	defer pubSub.Close()
+	cfg := config.Defaults("report-service", ":0")
+	router, err := startRouter(context.Background(), cfg, pubSub, pubSub, ts.ReportService, ts.deadLetters, ts.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Shutdown(context.Background())
+
+	// Act, an undecodable event and a valid one
+	poisoned := message.NewMessage("message-1", []byte(`{"order_id":`))
+	poisoned.Metadata.Set(eventTypeKey, "OrderCreated")
+	assert.NoError(t, pubSub.Publish(cfg.Broker.OrdersQueue, poisoned))
+	assert.NoError(t, pubSub.Publish(cfg.Broker.OrdersQueue, orderCreatedMessage(t, "message-2",
+		OrderCreatedEvent{OrderID: "order-1", TotalPrice: 100, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-01T10:00:00Z"})))
+
+	// Assert, the undecodable event is dead-lettered without retries
+	var letters []DeadLetter
+	assert.Eventually(t, func() bool {
+		letters, err = ts.deadLetters.store.List(context.Background(), false)
+		return err == nil && len(letters) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "message-1", letters[0].MessageUUID)
+	assert.Equal(t, cfg.Broker.OrdersQueue, letters[0].Topic)
+	assert.Equal(t, "process_order_created_event", letters[0].Handler)
+	assert.Contains(t, letters[0].Reason, "unexpected end of JSON input")
+	assert.Equal(t, `{"order_id":`, string(letters[0].Payload))
+
+	assert.Eventually(t, func() bool {
+		_, err := ts.store.Get(context.Background(), "order-1")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	logged, err := ts.store.CountEvents(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), logged)
+}
+
+// deadLetterMessage is a message as moved to the dead-letter queue by the
+// poison queue middleware
+func deadLetterMessage(uuid string) *message.Message {
+	msg := message.NewMessage(uuid, []byte(`{"order_id":`))
+	msg.Metadata.Set(eventTypeKey, "OrderCreated")
+	msg.Metadata.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "unexpected end of JSON input")
+	msg.Metadata.Set(middleware.PoisonedTopicKey, "orders")
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, "process_order_created_event")
+	msg.Metadata.Set(middleware.PoisonedSubscriberKey, "amqp.Subscriber")
+	return msg
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	ts := newTestReportService(t)
+	assert.NoError(t, ts.deadLetters.handleDeadLetter(deadLetterMessage("message-1")))
+
+	// Act
+	rr := ts.serve("POST", "/dlq/1/replay")
+
+	// Assert, the message is published with its original UUID and metadata
+	assert.Equal(t, http.StatusOK, rr.Code)
+	published := ts.publisher.published()
+	assert.Len(t, published, 1)
+	assert.Equal(t, []string{"orders"}, ts.publisher.topics)
+	assert.Equal(t, "message-1", published[0].UUID)
+	assert.Equal(t, `{"order_id":`, string(published[0].Payload))
+	assert.Equal(t, message.Metadata{
+		eventTypeKey:  "OrderCreated",
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}, published[0].Metadata)
+
+	// A replayed dead letter is listed with all=true only
+	pending := decodeJSON[struct{ Total int }](t, ts.serve("GET", "/dlq").Body.Bytes())
+	assert.Equal(t, 0, pending.Total)
+	all := decodeJSON[struct {
+		Messages []struct {
+			ReplayedAt *time.Time `json:"replayed_at"`
+		}
+	}](t, ts.serve("GET", "/dlq?all=true").Body.Bytes())
+	assert.Len(t, all.Messages, 1)
+	assert.NotNil(t, all.Messages[0].ReplayedAt)
+
+	// It is replayed once
+	assert.Equal(t, http.StatusConflict, ts.serve("POST", "/dlq/1/replay").Code)
+	assert.Len(t, ts.publisher.published(), 1)
+
+	// Dead-lettered again, it is pending again
+	assert.NoError(t, ts.deadLetters.handleDeadLetter(deadLetterMessage("message-1")))
+	letter, err := ts.deadLetters.store.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, letter.DeadCount)
+	assert.Nil(t, letter.ReplayedAt)
+	assert.Equal(t, http.StatusOK, ts.serve("POST", "/dlq/1/replay").Code)
+}
+
+func TestReplayDeadLetterProblems(t *testing.T) {
+	ts := newTestReportService(t)
+	assert.NoError(t, ts.deadLetters.handleDeadLetter(deadLetterMessage("message-1")))
+
+	assert.Equal(t, http.StatusNotFound, ts.serve("POST", "/dlq/9/replay").Code)
+	assert.Equal(t, http.StatusBadRequest, ts.serve("POST", "/dlq/abc/replay").Code)
+
+	// A failed publication leaves the dead letter replayable
+	ts.publisher.err = errors.New("broker unreachable")
+	assert.Equal(t, http.StatusBadGateway, ts.serve("POST", "/dlq/1/replay").Code)
+	letter, err := ts.deadLetters.store.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Nil(t, letter.ReplayedAt)
+
+	ts.publisher.err = nil
+	assert.Equal(t, http.StatusOK, ts.serve("POST", "/dlq/1/replay").Code)
+}
+
+func TestDeadLetterWithoutTopicIsReplayedOnOrders(t *testing.T) {
+	ts := newTestReportService(t)
+	msg := message.NewMessage("message-1", []byte(`not json`))
+
+	assert.NoError(t, ts.deadLetters.handleDeadLetter(msg))
+	rr := ts.serve("POST", "/dlq/1/replay")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"orders"}, ts.publisher.topics)
+	// An invalid JSON payload is listed as a string
+	letter := decodeJSON[map[string]any](t, rr.Body.Bytes())
+	assert.Equal(t, "not json", letter["payload"])
+}
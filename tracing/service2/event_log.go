@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sqlstore"
+	"time"
+)
+
+// LoggedEvent is a consumed event as it was received, kept in the event
+// log to rebuild the reports from
+type LoggedEvent struct {
+	Seq         int64
+	MessageUUID string
+	EventType   string
+	Payload     []byte
+	Metadata    map[string]string
+	ReceivedAt  time.Time
+}
+
+// AppendEvent adds an event to the log and returns its sequence number. A
+// redelivered message is logged once, its first sequence number is returned.
+func (s *ReportStore) AppendEvent(ctx context.Context, event LoggedEvent) (int64, error) {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	var seq int64
+	err = s.db.QueryRowContext(ctx, `INSERT INTO event_log (message_uuid, event_type, payload, metadata, received_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (message_uuid) DO UPDATE SET message_uuid = excluded.message_uuid
+		RETURNING seq`,
+		event.MessageUUID, event.EventType, event.Payload, string(metadata), sqlstore.FormatTime(event.ReceivedAt)).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("append event %s: %w", event.MessageUUID, err)
+	}
+	return seq, nil
+}
+
+// EventsAfter returns up to limit logged events after the event with
+// sequence number seq, in the order they were logged
+func (s *ReportStore) EventsAfter(ctx context.Context, seq int64, limit int) ([]LoggedEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT seq, message_uuid, event_type, payload, metadata, received_at
+		FROM event_log WHERE seq > ? ORDER BY seq LIMIT ?`, seq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []LoggedEvent
+	for rows.Next() {
+		var event LoggedEvent
+		var metadata string
+		var receivedAt string
+		if err := rows.Scan(&event.Seq, &event.MessageUUID, &event.EventType, &event.Payload, &metadata, &receivedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			return nil, fmt.Errorf("logged event %d: metadata: %w", event.Seq, err)
+		}
+		if event.ReceivedAt, err = sqlstore.ParseTime(receivedAt); err != nil {
+			return nil, fmt.Errorf("logged event %d: received_at: %w", event.Seq, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// LastEventSeq returns the sequence number of the last logged event, 0
+// when the log is empty
+func (s *ReportStore) LastEventSeq(ctx context.Context) (int64, error) {
+	var seq sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(seq) FROM event_log`).Scan(&seq); err != nil {
+		return 0, err
+	}
+	return seq.Int64, nil
+}
+
+// decodeOrderCreated decodes the payload of a logged OrderCreated event
+func decodeOrderCreated(event LoggedEvent) (OrderCreatedEvent, error) {
+	var created OrderCreatedEvent
+	if event.EventType != "OrderCreated" {
+		return created, fmt.Errorf("logged event %d: unexpected event type %q", event.Seq, event.EventType)
+	}
+	if err := json.Unmarshal(event.Payload, &created); err != nil {
+		return created, fmt.Errorf("logged event %d: %w", event.Seq, err)
+	}
+	return created, nil
+}
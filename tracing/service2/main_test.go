@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+)
+
+// testPublisher records the published messages, or fails with err
+type testPublisher struct {
+	mu       sync.Mutex
+	err      error
+	topics   []string
+	messages []*message.Message
+}
+
+func (p *testPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	for _, msg := range messages {
+		p.topics = append(p.topics, topic)
+		p.messages = append(p.messages, msg)
+	}
+	return nil
+}
+
+func (p *testPublisher) Close() error {
+	return nil
+}
+
+func (p *testPublisher) published() []*message.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*message.Message(nil), p.messages...)
+}
+
+// testReportService is the report service over temporary SQLite stores and
+// an in-memory dedup store, routed as in main
+type testReportService struct {
+	*ReportService
+	deadLetters *DeadLetterService
+	rebuilder   *Rebuilder
+	publisher   *testPublisher
+	handler     http.Handler
+}
+
+func newTestReportService(t *testing.T) *testReportService {
+	dir := t.TempDir()
+	reports, err := OpenReportStore(filepath.Join(dir, "reports.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reports.Close() })
+	deadLetters, err := OpenDeadLetterStore(filepath.Join(dir, "deadletters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { deadLetters.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ts := &testReportService{
+		ReportService: &ReportService{
+			store:  reports,
+			dedup:  NewMemoryDedupStore(time.Hour, testDedupMaxEntries),
+			broker: NewReportBroker(),
+			logger: logger,
+		},
+		publisher: &testPublisher{},
+	}
+	ts.deadLetters = &DeadLetterService{
+		store:       deadLetters,
+		publisher:   ts.publisher,
+		ordersTopic: "orders",
+		tracer:      otel.Tracer("report-service"),
+		logger:      logger,
+	}
+	ts.rebuilder = NewRebuilder(ts.ReportService, otel.Tracer("report-service"), logger)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerRoutes(r, ts.ReportService, ts.deadLetters, ts.rebuilder)
+	ts.handler = r
+	return ts
+}
+
+// orderCreatedMessage is an OrderCreated event as published by service1
+func orderCreatedMessage(t *testing.T, uuid string, event OrderCreatedEvent) *message.Message {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := message.NewMessage(uuid, payload)
+	msg.Metadata.Set(eventTypeKey, "OrderCreated")
+	return msg
+}
+
+// consume handles an OrderCreated event as the router would
+func (ts *testReportService) consume(t *testing.T, uuid string, event OrderCreatedEvent) {
+	if err := ts.handleOrderCreated(orderCreatedMessage(t, uuid, event)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (ts *testReportService) serve(method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(""))
+	rr := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeJSON[T any](t *testing.T, body []byte) T {
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return v
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	eventTypeKey          = "event_type"
+	messageHandlerTimeout = 30 * time.Second
+)
+
+// permanentError marks a failure that fails again on every attempt, like
+// a payload that cannot be decoded, so the message is not retried
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var target permanentError
+	return errors.As(err, &target)
+}
+
+// newRetry retries a failing message 3 times with a backoff from 100ms to 2s
+func newRetry(logger watermill.LoggerAdapter) middleware.Retry {
+	return middleware.Retry{
+		MaxRetries:          3,
+		InitialInterval:     100 * time.Millisecond,
+		MaxInterval:         2 * time.Second,
+		Multiplier:          2,
+		RandomizationFactor: 0.2,
+		Logger:              logger,
+	}
+}
+
+// retryTransient applies retry to the handler errors except the permanent
+// ones, which are returned after the first attempt
+func retryTransient(retry middleware.Retry) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			var permanentErr error
+			retried := retry.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+				events, err := h(msg)
+				if isPermanent(err) {
+					// Stop the retries, the error is returned below
+					permanentErr = err
+					return nil, nil
+				}
+				return events, err
+			})
+
+			events, err := retried(msg)
+			if permanentErr != nil {
+				return nil, permanentErr
+			}
+			return events, err
+		}
+	}
+}
+
+// detachContext keeps the closing router from cancelling the context of a
+// message, which it derives from the subscription, so that the message being
+// handled on shutdown is finished and acked. The handler timeout still
+// bounds each attempt.
+func detachContext(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msg.SetContext(context.WithoutCancel(msg.Context()))
+		return h(msg)
+	}
+}
+
+// correlationID gives a message without a correlation ID its own UUID as
+// one, and copies it to the messages produced by the handler
+func correlationID(h message.HandlerFunc) message.HandlerFunc {
+	return middleware.CorrelationID(func(msg *message.Message) ([]*message.Message, error) {
+		middleware.SetCorrelationID(msg.UUID, msg)
+		return h(msg)
+	})
+}
+
+// tracing continues the trace propagated in the message metadata with a
+// span named after the handler
+func tracing(tracer trace.Tracer) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := otel.GetTextMapPropagator().Extract(msg.Context(), propagation.MapCarrier(msg.Metadata))
+			ctx, span := tracer.Start(ctx, message.HandlerNameFromCtx(ctx), trace.WithSpanKind(trace.SpanKindConsumer))
+			defer span.End()
+
+			span.SetAttributes(
+				attribute.String("message.id", msg.UUID),
+				attribute.String("message.topic", message.SubscribeTopicFromCtx(ctx)),
+				attribute.String("message.correlation_id", middleware.MessageCorrelationID(msg)),
+			)
+			if eventType := msg.Metadata.Get(eventTypeKey); eventType != "" {
+				span.SetAttributes(attribute.String("event.type", eventType))
+			}
+
+			msg.SetContext(ctx)
+			events, err := h(msg)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return events, err
+		}
+	}
+}
+
+type loggerKey struct{}
+
+// messageLogger returns the logger of the message handled with ctx, or
+// fallback outside of a handler
+func messageLogger(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// logging gives the handler a logger carrying the IDs of the message, see
+// messageLogger, and logs the outcome of every message
+func logging(logger *slog.Logger) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := msg.Context()
+			spanCtx := trace.SpanContextFromContext(ctx)
+			msgLogger := logger.With(
+				slog.String("message_id", msg.UUID),
+				slog.String("correlation_id", middleware.MessageCorrelationID(msg)),
+				slog.String("handler", message.HandlerNameFromCtx(ctx)),
+				slog.String("topic", message.SubscribeTopicFromCtx(ctx)),
+				slog.String("trace_id", spanCtx.TraceID().String()),
+				slog.String("span_id", spanCtx.SpanID().String()),
+			)
+			msg.SetContext(context.WithValue(ctx, loggerKey{}, msgLogger))
+
+			start := time.Now()
+			events, err := h(msg)
+			if err != nil {
+				msgLogger.Error("Failed to handle message",
+					slog.String("error", err.Error()),
+					slog.Duration("duration", time.Since(start)),
+				)
+				return events, err
+			}
+			msgLogger.Info("Message handled", slog.Duration("duration", time.Since(start)))
+			return events, nil
+		}
+	}
+}
+
+// timeout cancels the context of the message after d. Unlike
+// middleware.Timeout it restores the context afterwards, so a retried
+// attempt gets its own d.
+func timeout(d time.Duration) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			parent := msg.Context()
+			ctx, cancel := context.WithTimeout(parent, d)
+			defer func() {
+				cancel()
+				msg.SetContext(parent)
+			}()
+
+			msg.SetContext(ctx)
+			return h(msg)
+		}
+	}
+}
+
+// eventTypeFilter acks the messages of other event types without handling
+// them. Messages without event_type are handled, they predate it.
+func eventTypeFilter(eventType string) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			if other := msg.Metadata.Get(eventTypeKey); other != "" && other != eventType {
+				messageLogger(msg.Context(), slog.Default()).Info("Skipping event of another type",
+					slog.String("event_type", other),
+				)
+				return nil, nil
+			}
+			return h(msg)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"sqlstore"
+)
+
+// The migrations of each database are in their own directory
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrate applies the pending migrations of migrations/dir to db
+func migrate(db *sql.DB, dir string) error {
+	migrations, err := fs.Sub(migrationFiles, "migrations/"+dir)
+	if err != nil {
+		return err
+	}
+	return sqlstore.Migrate(db, migrations)
+}
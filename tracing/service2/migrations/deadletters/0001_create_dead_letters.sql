@@ -0,0 +1,12 @@
+CREATE TABLE dead_letters (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_uuid TEXT NOT NULL UNIQUE,
+    topic        TEXT NOT NULL,
+    handler      TEXT NOT NULL,
+    reason       TEXT NOT NULL,
+    payload      BLOB NOT NULL,
+    metadata     TEXT NOT NULL,
+    dead_count   INTEGER NOT NULL DEFAULT 1,
+    received_at  TEXT NOT NULL,
+    replayed_at  TEXT
+);
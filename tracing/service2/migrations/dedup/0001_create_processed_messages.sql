@@ -0,0 +1,6 @@
+CREATE TABLE processed_messages (
+    key       TEXT PRIMARY KEY,
+    marked_at TEXT NOT NULL
+);
+
+CREATE INDEX processed_messages_marked_at ON processed_messages (marked_at);
@@ -0,0 +1,13 @@
+-- The rowid of a report is the sequence number of its event in the event log
+CREATE TABLE reports (
+    order_id     TEXT PRIMARY KEY,
+    total_price  INTEGER NOT NULL,
+    customer_id  INTEGER NOT NULL,
+    product_id   INTEGER NOT NULL,
+    created_at   TEXT NOT NULL,
+    processed_at TEXT NOT NULL
+);
+
+CREATE INDEX reports_customer_id ON reports (customer_id, created_at);
+CREATE INDEX reports_product_id ON reports (product_id, created_at);
+CREATE INDEX reports_created_at ON reports (created_at);
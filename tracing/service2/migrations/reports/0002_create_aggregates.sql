@@ -0,0 +1,25 @@
+-- Maintained in the transaction storing each report, a rebuild creates
+-- them again as rebuild_* tables and swaps them in
+CREATE TABLE customer_totals (
+    customer_id    INTEGER PRIMARY KEY,
+    order_count    INTEGER NOT NULL,
+    revenue        INTEGER NOT NULL,
+    first_order_at TEXT NOT NULL,
+    last_order_at  TEXT NOT NULL
+);
+
+CREATE TABLE product_totals (
+    product_id     INTEGER PRIMARY KEY,
+    order_count    INTEGER NOT NULL,
+    revenue        INTEGER NOT NULL,
+    first_order_at TEXT NOT NULL,
+    last_order_at  TEXT NOT NULL
+);
+
+CREATE TABLE revenue_buckets (
+    granularity  TEXT NOT NULL,
+    bucket_start TEXT NOT NULL,
+    order_count  INTEGER NOT NULL,
+    revenue      INTEGER NOT NULL,
+    PRIMARY KEY (granularity, bucket_start)
+);
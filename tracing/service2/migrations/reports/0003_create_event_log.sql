@@ -0,0 +1,9 @@
+-- Consumed events as they were received, the reports are rebuilt from them
+CREATE TABLE event_log (
+    seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_uuid TEXT NOT NULL UNIQUE,
+    event_type   TEXT NOT NULL,
+    payload      BLOB NOT NULL,
+    metadata     TEXT NOT NULL,
+    received_at  TEXT NOT NULL
+);
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const rebuildBatchSize = 500
+
+var (
+	errRebuildRunning = errors.New("a rebuild is already running")
+	errRebuildStopped = errors.New("the report service is shutting down")
+)
+
+// RebuildState is the state of the last rebuild
+type RebuildState string
+
+const (
+	RebuildIdle      RebuildState = "idle"
+	RebuildRunning   RebuildState = "running"
+	RebuildCompleted RebuildState = "completed"
+	RebuildFailed    RebuildState = "failed"
+)
+
+// RebuildStatus reports the progress of the last rebuild
+type RebuildStatus struct {
+	State      RebuildState `json:"state"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	// Processed counts the events replayed out of Total, the events logged
+	// so far. Total grows while live events are logged during the rebuild.
+	Processed int64 `json:"processed"`
+	Total     int64 `json:"total"`
+	// Reports counts the reports rebuilt, the events of an order after the
+	// first one make none
+	Reports int64 `json:"reports"`
+	// Skipped counts the events that could not be decoded
+	Skipped int64  `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ResetRebuild drops what a previous rebuild left and creates empty
+// rebuild tables
+func (s *ReportStore) ResetRebuild(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, rebuildTables.drop()+";"+rebuildTables.create())
+	return err
+}
+
+// RebuildReports stores reports in the rebuild tables and returns how many
+// were new
+func (s *ReportStore) RebuildReports(ctx context.Context, reports []SequencedReport) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted := 0
+	for _, sequenced := range reports {
+		ok, err := insertReport(ctx, tx, rebuildTables, sequenced.Seq, sequenced.Report)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			inserted++
+		}
+	}
+
+	return inserted, tx.Commit()
+}
+
+// CountEvents returns the number of logged events
+func (s *ReportStore) CountEvents(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM event_log`).Scan(&count)
+	return count, err
+}
+
+// SwapRebuild replaces the live reports and aggregates with the rebuilt ones
+func (s *ReportStore) SwapRebuild(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, liveTables.drop()); err != nil {
+		return err
+	}
+	for _, rename := range [][2]string{
+		{rebuildTables.reports, liveTables.reports},
+		{rebuildTables.customerTotals, liveTables.customerTotals},
+		{rebuildTables.productTotals, liveTables.productTotals},
+		{rebuildTables.revenueBuckets, liveTables.revenueBuckets},
+	} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, rename[0], rename[1])); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, reportIndexes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Rebuilder rebuilds the reports and aggregates from the event log. The
+// rebuild runs next to the live consumer, which is only held back while the
+// rebuilt tables replace the live ones.
+type Rebuilder struct {
+	service *ReportService
+	tracer  trace.Tracer
+	logger  *slog.Logger
+
+	// ctx is cancelled by Shutdown, which waits for the rebuild in running
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	mu     sync.Mutex
+	status RebuildStatus
+}
+
+func NewRebuilder(service *ReportService, tracer trace.Tracer, logger *slog.Logger) *Rebuilder {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Rebuilder{
+		service: service,
+		tracer:  tracer,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		status:  RebuildStatus{State: RebuildIdle},
+	}
+}
+
+// Start starts a rebuild in the background, or returns errRebuildRunning,
+// or errRebuildStopped after Shutdown
+func (b *Rebuilder) Start() (RebuildStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ctx.Err() != nil {
+		return b.status, errRebuildStopped
+	}
+	if b.status.State == RebuildRunning {
+		return b.status, errRebuildRunning
+	}
+	startedAt := time.Now().UTC()
+	b.status = RebuildStatus{State: RebuildRunning, StartedAt: &startedAt}
+
+	b.running.Add(1)
+	go func() {
+		defer b.running.Done()
+		b.run(b.ctx)
+	}()
+	return b.status, nil
+}
+
+// Shutdown cancels the running rebuild and waits for it to stop, or for
+// ctx to be done. A cancelled rebuild fails and leaves the live tables as
+// they were.
+func (b *Rebuilder) Shutdown(ctx context.Context) error {
+	// Under the lock so that Start cannot start a rebuild after the cancel
+	b.mu.Lock()
+	b.cancel()
+	b.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the progress of the running or last rebuild
+func (b *Rebuilder) Status() RebuildStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
+
+func (b *Rebuilder) update(fn func(*RebuildStatus)) {
+	b.mu.Lock()
+	fn(&b.status)
+	b.mu.Unlock()
+}
+
+func (b *Rebuilder) run(ctx context.Context) {
+	ctx, span := b.tracer.Start(ctx, "rebuild_reports")
+	defer span.End()
+
+	b.logger.Info("Rebuilding reports from the event log")
+	err := b.rebuild(ctx)
+
+	finishedAt := time.Now().UTC()
+	b.update(func(status *RebuildStatus) {
+		status.FinishedAt = &finishedAt
+		if err != nil {
+			status.State = RebuildFailed
+			status.Error = err.Error()
+			return
+		}
+		status.State = RebuildCompleted
+	})
+
+	status := b.Status()
+	span.SetAttributes(
+		attribute.Int64("rebuild.processed", status.Processed),
+		attribute.Int64("rebuild.reports", status.Reports),
+		attribute.Int64("rebuild.skipped", status.Skipped),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		b.logger.Error("Failed to rebuild reports", slog.String("error", err.Error()))
+		return
+	}
+	b.logger.Info("Reports rebuilt",
+		slog.Int64("processed", status.Processed),
+		slog.Int64("reports", status.Reports),
+		slog.Int64("skipped", status.Skipped),
+		slog.Duration("duration", finishedAt.Sub(*status.StartedAt)),
+	)
+}
+
+func (b *Rebuilder) rebuild(ctx context.Context) error {
+	store := b.service.store
+	if err := store.ResetRebuild(ctx); err != nil {
+		return fmt.Errorf("reset rebuild tables: %w", err)
+	}
+
+	total, err := store.CountEvents(ctx)
+	if err != nil {
+		return err
+	}
+	b.update(func(status *RebuildStatus) { status.Total = total })
+
+	// Replay the log while the live consumer keeps running
+	last, err := b.replay(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	// Hold the live consumer back to replay the events it logged meanwhile
+	// and swap the tables, no event is stored in between
+	b.service.mu.Lock()
+	defer b.service.mu.Unlock()
+
+	if _, err := b.replay(ctx, last); err != nil {
+		return err
+	}
+	if err := store.SwapRebuild(ctx); err != nil {
+		return fmt.Errorf("swap rebuilt tables: %w", err)
+	}
+	return nil
+}
+
+// replay rebuilds the reports of the events logged after seq, and returns
+// the sequence number of the last one
+func (b *Rebuilder) replay(ctx context.Context, seq int64) (int64, error) {
+	for {
+		events, err := b.service.store.EventsAfter(ctx, seq, rebuildBatchSize)
+		if err != nil {
+			return seq, err
+		}
+		if len(events) == 0 {
+			return seq, nil
+		}
+
+		reports := make([]SequencedReport, 0, len(events))
+		skipped := 0
+		for _, event := range events {
+			created, err := decodeOrderCreated(event)
+			if err != nil {
+				skipped++
+				b.logger.Warn("Skipping logged event", slog.String("error", err.Error()), slog.String("message_id", event.MessageUUID))
+				continue
+			}
+			// The parse error was logged when the event was consumed
+			report, _ := projectReport(created, event.ReceivedAt)
+			reports = append(reports, SequencedReport{Seq: event.Seq, Report: report})
+		}
+
+		inserted, err := b.service.store.RebuildReports(ctx, reports)
+		if err != nil {
+			return seq, err
+		}
+		seq = events[len(events)-1].Seq
+
+		b.update(func(status *RebuildStatus) {
+			status.Processed += int64(len(events))
+			status.Total = max(status.Total, status.Processed)
+			status.Reports += int64(inserted)
+			status.Skipped += int64(skipped)
+		})
+		b.logger.Info("Rebuild progress", slog.Int64("seq", seq), slog.Int64("processed", b.Status().Processed))
+	}
+}
+
+// startRebuild starts a rebuild, POST /admin/rebuild
+func (b *Rebuilder) startRebuild(c *gin.Context) {
+	status, err := b.Start()
+	if errors.Is(err, errRebuildRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "rebuild": status})
+		return
+	}
+	if errors.Is(err, errRebuildStopped) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, status)
+}
+
+// getRebuild returns the progress of the rebuild, GET /admin/rebuild
+func (b *Rebuilder) getRebuild(c *gin.Context) {
+	c.JSON(http.StatusOK, b.Status())
+}
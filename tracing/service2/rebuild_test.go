@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// projectionPaths read every report and aggregate
+var projectionPaths = []string{
+	"/reports?limit=500",
+	"/reports/summary?granularity=day",
+	"/reports/summary?granularity=hour",
+	"/reports/customers/1",
+	"/reports/customers/2",
+	"/reports/products/1",
+	"/reports/products/2",
+}
+
+func (ts *testReportService) projections(t *testing.T) map[string]string {
+	bodies := map[string]string{}
+	for _, path := range projectionPaths {
+		rr := ts.serve("GET", path)
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		bodies[path] = rr.Body.String()
+	}
+	return bodies
+}
+
+// waitForRebuild waits for the rebuild to finish and returns its status
+func (ts *testReportService) waitForRebuild(t *testing.T) RebuildStatus {
+	var status RebuildStatus
+	assert.Eventually(t, func() bool {
+		status = decodeJSON[RebuildStatus](t, ts.serve("GET", "/admin/rebuild").Body.Bytes())
+		return status.State != RebuildRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func (ts *testReportService) appendEvent(t *testing.T, uuid string, payload []byte) {
+	_, err := ts.store.AppendEvent(context.Background(), LoggedEvent{
+		MessageUUID: uuid,
+		EventType:   "OrderCreated",
+		Payload:     payload,
+		ReceivedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+	// A republished order, and an event logged by an older version that
+	// cannot be decoded any more
+	ts.consume(t, "message-9", testOrders[0])
+	ts.appendEvent(t, "message-10", []byte(`{"order_id":`))
+	live := ts.projections(t)
+
+	// The aggregates drifted from the reports
+	if _, err := ts.store.db.Exec(`DELETE FROM customer_totals; UPDATE product_totals SET revenue = 0`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	rr := ts.serve("POST", "/admin/rebuild")
+
+	// Assert, the rebuilt projections equal the live ones before the drift
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	status := ts.waitForRebuild(t)
+	assert.Equal(t, RebuildCompleted, status.State)
+	assert.Empty(t, status.Error)
+	assert.Equal(t, int64(6), status.Processed)
+	assert.Equal(t, int64(6), status.Total)
+	assert.Equal(t, int64(4), status.Reports)
+	assert.Equal(t, int64(1), status.Skipped)
+	assert.NotNil(t, status.FinishedAt)
+	assert.Equal(t, live, ts.projections(t))
+
+	// The rebuild tables were renamed to the live ones
+	var tables int
+	err := ts.store.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE ?`,
+		rebuildTables.reports).Scan(&tables)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, tables)
+
+	// Another rebuild gives the same projections
+	assert.Equal(t, http.StatusAccepted, ts.serve("POST", "/admin/rebuild").Code)
+	assert.Equal(t, RebuildCompleted, ts.waitForRebuild(t).State)
+	assert.Equal(t, live, ts.projections(t))
+}
+
+func TestRebuildCatchesUpWithLiveEvents(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	// Hold the live consumer back, the rebuild waits for it to swap the tables
+	ts.mu.Lock()
+	assert.Equal(t, http.StatusAccepted, ts.serve("POST", "/admin/rebuild").Code)
+	assert.Eventually(t, func() bool {
+		return ts.rebuilder.Status().Processed == int64(len(testOrders))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Act, an event is logged after the replay and a second rebuild is refused
+	payload, err := json.Marshal(OrderCreatedEvent{OrderID: "order-5", TotalPrice: 40, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-03T08:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.appendEvent(t, "message-5", payload)
+	rr := ts.serve("POST", "/admin/rebuild")
+	ts.mu.Unlock()
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	status := ts.waitForRebuild(t)
+	assert.Equal(t, RebuildCompleted, status.State)
+	assert.Equal(t, int64(5), status.Processed)
+	assert.Equal(t, int64(5), status.Reports)
+
+	assert.Equal(t, http.StatusOK, ts.serve("GET", "/reports/order-5").Code)
+	customer := decodeJSON[CustomerTotals](t, ts.serve("GET", "/reports/customers/1").Body.Bytes())
+	assert.Equal(t, Totals{OrderCount: 3, Revenue: 390, AverageOrderValue: 130}, customer.Totals)
+}
+
+func TestRebuildShutdown(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+	live := ts.projections(t)
+
+	// Hold the live consumer back, the rebuild waits for it to swap the tables
+	ts.mu.Lock()
+	assert.Equal(t, http.StatusAccepted, ts.serve("POST", "/admin/rebuild").Code)
+	assert.Eventually(t, func() bool {
+		return ts.rebuilder.Status().Processed == int64(len(testOrders))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- ts.rebuilder.Shutdown(ctx)
+	}()
+	<-ts.rebuilder.ctx.Done()
+	ts.mu.Unlock()
+
+	// Assert, the rebuild stopped before the swap and no other one starts
+	assert.NoError(t, <-stopped)
+	assert.Equal(t, RebuildFailed, ts.rebuilder.Status().State)
+	assert.Equal(t, live, ts.projections(t))
+	assert.Equal(t, http.StatusServiceUnavailable, ts.serve("POST", "/admin/rebuild").Code)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (rs *ReportService) getReports(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	query, err := parseReportQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports, total, err := rs.store.Find(ctx, query)
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int("reports.count", len(reports)),
+		attribute.Int("reports.total", total),
+	)
+	rs.logger.Info("Reports retrieved",
+		slog.Int("count", len(reports)),
+		slog.Int("total_reports", total),
+		slog.String("request_id", c.GetHeader("X-Request-ID")),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+		"total":   total,
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
+
+func (rs *ReportService) getReport(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	report, err := rs.store.Get(ctx, c.Param("order_id"))
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+
+	span.SetAttributes(attribute.String("order.id", report.OrderID))
+	c.JSON(http.StatusOK, report)
+}
+
+// getSummary returns the totals of all the orders and their revenue per
+// hour or day bucket
+func (rs *ReportService) getSummary(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	granularity := c.DefaultQuery("granularity", "day")
+	if _, ok := bucketSizes[granularity]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hour or day"})
+		return
+	}
+	from, err := queryTime(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	totals, err := rs.store.Totals(ctx)
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+	buckets, err := rs.store.RevenueBuckets(ctx, granularity, from, to)
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totals":      totals,
+		"granularity": granularity,
+		"buckets":     buckets,
+	})
+}
+
+func (rs *ReportService) getCustomerTotals(c *gin.Context) {
+	customerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || customerID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	totals, err := rs.store.CustomerTotals(c.Request.Context(), customerID)
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, totals)
+}
+
+func (rs *ReportService) getProductTotals(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || productID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	totals, err := rs.store.ProductTotals(c.Request.Context(), productID)
+	if err != nil {
+		rs.writeReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, totals)
+}
+
+// parseReportQuery reads the filters, page and sort order of GET /reports
+func parseReportQuery(c *gin.Context) (ReportQuery, error) {
+	query := ReportQuery{Limit: defaultReportLimit, SortBy: "created_at"}
+
+	var err error
+	if query.CustomerID, err = positiveQueryInt(c, "customer_id", 0); err != nil {
+		return query, err
+	}
+	if query.ProductID, err = positiveQueryInt(c, "product_id", 0); err != nil {
+		return query, err
+	}
+	if query.CreatedFrom, err = queryTime(c, "from"); err != nil {
+		return query, err
+	}
+	if query.CreatedTo, err = queryTime(c, "to"); err != nil {
+		return query, err
+	}
+	if !query.CreatedFrom.IsZero() && !query.CreatedTo.IsZero() && !query.CreatedFrom.Before(query.CreatedTo) {
+		return query, errors.New("from must be before to")
+	}
+
+	if query.Limit, err = positiveQueryInt(c, "limit", defaultReportLimit); err != nil {
+		return query, err
+	}
+	if query.Limit > maxReportLimit {
+		return query, fmt.Errorf("limit must be at most %d", maxReportLimit)
+	}
+	if value := c.Query("offset"); value != "" {
+		query.Offset, err = strconv.Atoi(value)
+		if err != nil || query.Offset < 0 {
+			return query, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	if value := c.Query("sort"); value != "" {
+		if _, ok := reportSortColumns[value]; !ok {
+			return query, errors.New("sort must be created_at, processed_at or total_price")
+		}
+		query.SortBy = value
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	return query, nil
+}
+
+// positiveQueryInt reads a positive integer query parameter, or def when
+// it is absent
+func positiveQueryInt(c *gin.Context, name string, def int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return parsed, nil
+}
+
+// queryTime reads an RFC 3339 query parameter, the zero time when it is absent
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return parsed, nil
+}
+
+// writeReportError maps the report errors to HTTP responses
+func (rs *ReportService) writeReportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errReportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	case errors.Is(err, errNoOrders):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No orders found"})
+		return
+	}
+
+	span := trace.SpanFromContext(c.Request.Context())
+	span.SetAttributes(attribute.String("error", err.Error()))
+	rs.logger.Error("Failed to read reports",
+		slog.String("error", err.Error()),
+		slog.String("path", c.Request.URL.Path),
+	)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read reports"})
+}
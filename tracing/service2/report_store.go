@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sqlstore"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReportLimit = 50
+	maxReportLimit     = 500
+)
+
+var errReportNotFound = errors.New("report not found")
+
+// reportSortColumns are the columns reports can be sorted by
+var reportSortColumns = map[string]string{
+	"created_at":   "created_at",
+	"processed_at": "processed_at",
+	"total_price":  "total_price",
+}
+
+// ReportQuery filters and pages the reports, zero fields do not filter
+type ReportQuery struct {
+	CustomerID int
+	ProductID  int
+	// CreatedFrom is inclusive and CreatedTo exclusive
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	Limit  int
+	Offset int
+	// SortBy is a key of reportSortColumns
+	SortBy string
+	Desc   bool
+}
+
+// ReportStore persists the order reports in SQLite
+type ReportStore struct {
+	db *sql.DB
+}
+
+// OpenReportStore opens (or creates) the report database at path and
+// applies any pending schema migrations
+func OpenReportStore(path string) (*ReportStore, error) {
+	// Messages are handled concurrently, the transactions take the write
+	// lock up front (_txlock=immediate) instead of failing to upgrade to it
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, "reports"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &ReportStore{db: db}, nil
+}
+
+func (s *ReportStore) Close() error {
+	return s.db.Close()
+}
+
+// Save stores the report of the event with sequence number seq and adds
+// it to the aggregates, and reports whether it did. A report of the same
+// order is kept as it is.
+func (s *ReportStore) Save(ctx context.Context, seq int64, report OrderReport) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := insertReport(ctx, tx, liveTables, seq, report)
+	if err != nil || !inserted {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// insertReport stores a report in tables with seq as its rowid, and adds
+// it to their aggregates unless the order already has a report
+func insertReport(ctx context.Context, tx *sql.Tx, tables reportTables, seq int64, report OrderReport) (bool, error) {
+	res, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO `+tables.reports+` (rowid, `+reportColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		seq, report.OrderID, report.TotalPrice, report.CustomerID, report.ProductID,
+		sqlstore.FormatTime(report.CreatedAt), sqlstore.FormatTime(report.ProcessedAt))
+	if err != nil {
+		return false, fmt.Errorf("insert report %s: %w", report.OrderID, err)
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	if err := addToAggregates(ctx, tx, tables, report); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get finds the report of an order
+func (s *ReportStore) Get(ctx context.Context, orderID string) (*OrderReport, error) {
+	report, err := scanReport(s.db.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM reports WHERE order_id = ?`, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("report %s: %w", orderID, errReportNotFound)
+	}
+	return report, err
+}
+
+// Find returns a page of the reports matching q and the number of reports
+// matching it across all pages
+func (s *ReportStore) Find(ctx context.Context, q ReportQuery) ([]OrderReport, int, error) {
+	var conditions []string
+	var args []any
+	if q.CustomerID != 0 {
+		conditions = append(conditions, "customer_id = ?")
+		args = append(args, q.CustomerID)
+	}
+	if q.ProductID != 0 {
+		conditions = append(conditions, "product_id = ?")
+		args = append(args, q.ProductID)
+	}
+	if !q.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, sqlstore.FormatTime(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, sqlstore.FormatTime(q.CreatedTo))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reports`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := reportSortColumns[q.SortBy]
+	if !ok {
+		column = reportSortColumns["created_at"]
+	}
+	direction := "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultReportLimit
+	}
+
+	// order_id breaks ties so that pages do not overlap
+	query := fmt.Sprintf(`SELECT %s FROM reports%s ORDER BY %s %s, order_id %s LIMIT ? OFFSET ?`,
+		reportColumns, where, column, direction, direction)
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reports := []OrderReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		reports = append(reports, *report)
+	}
+
+	return reports, total, rows.Err()
+}
+
+// SequencedReport is a report with the sequence number of its event in the
+// event log, which orders the reports as they were stored
+type SequencedReport struct {
+	Seq    int64
+	Report OrderReport
+}
+
+// ReportsAfter returns up to limit reports of filter stored after the
+// report with sequence number seq, in the order they were stored
+func (s *ReportStore) ReportsAfter(ctx context.Context, seq int64, filter ReportFilter, limit int) ([]SequencedReport, error) {
+	conditions := []string{"rowid > ?"}
+	args := []any{seq}
+	if filter.CustomerID != 0 {
+		conditions = append(conditions, "customer_id = ?")
+		args = append(args, filter.CustomerID)
+	}
+	if filter.ProductID != 0 {
+		conditions = append(conditions, "product_id = ?")
+		args = append(args, filter.ProductID)
+	}
+
+	// The rowid of a report is the sequence number of its event
+	rows, err := s.db.QueryContext(ctx, `SELECT `+reportColumns+`, rowid FROM reports
+		WHERE `+strings.Join(conditions, " AND ")+` ORDER BY rowid LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []SequencedReport
+	for rows.Next() {
+		var seq int64
+		report, err := scanReport(rows, &seq)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, SequencedReport{Seq: seq, Report: *report})
+	}
+
+	return reports, rows.Err()
+}
+
+// reportIndexes are the indexes migrations/reports gives the live reports,
+// a rebuild creates them again after swapping the tables
+const reportIndexes = `CREATE INDEX IF NOT EXISTS reports_customer_id ON reports (customer_id, created_at);
+	CREATE INDEX IF NOT EXISTS reports_product_id ON reports (product_id, created_at);
+	CREATE INDEX IF NOT EXISTS reports_created_at ON reports (created_at)`
+
+// reportColumns are the columns read by scanReport
+const reportColumns = `order_id, total_price, customer_id, product_id, created_at, processed_at`
+
+// scanReport reads the reportColumns, followed by any extra columns into
+// extra
+func scanReport(row scanner, extra ...any) (*OrderReport, error) {
+	var report OrderReport
+	var createdAt, processedAt string
+	dest := append([]any{&report.OrderID, &report.TotalPrice, &report.CustomerID, &report.ProductID, &createdAt, &processedAt}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	if report.CreatedAt, err = sqlstore.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("report %s: created_at: %w", report.OrderID, err)
+	}
+	if report.ProcessedAt, err = sqlstore.ParseTime(processedAt); err != nil {
+		return nil, fmt.Errorf("report %s: processed_at: %w", report.OrderID, err)
+	}
+	return &report, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testOrders are consumed in order by consumeTestOrders. order-1 and
+// order-4 are created at the same time.
+var testOrders = []OrderCreatedEvent{
+	{OrderID: "order-1", TotalPrice: 100, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-01T10:00:00Z"},
+	{OrderID: "order-2", TotalPrice: 250, CustomerID: 1, ProductID: 2, CreatedAt: "2024-01-01T11:30:00Z"},
+	{OrderID: "order-3", TotalPrice: 50, CustomerID: 2, ProductID: 1, CreatedAt: "2024-01-02T09:00:00Z"},
+	{OrderID: "order-4", TotalPrice: 300, CustomerID: 2, ProductID: 2, CreatedAt: "2024-01-01T10:00:00Z"},
+}
+
+func (ts *testReportService) consumeTestOrders(t *testing.T) {
+	for i, event := range testOrders {
+		ts.consume(t, fmt.Sprintf("message-%d", i+1), event)
+	}
+}
+
+type reportsResponse struct {
+	Reports []OrderReport `json:"reports"`
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
+
+func orderIDs(reports []OrderReport) []string {
+	ids := []string{}
+	for _, report := range reports {
+		ids = append(ids, report.OrderID)
+	}
+	return ids
+}
+
+func TestGetReports(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		want      []string
+		wantTotal int
+	}{
+		{"all, oldest first", "", []string{"order-1", "order-4", "order-2", "order-3"}, 4},
+		{"customer", "?customer_id=1", []string{"order-1", "order-2"}, 2},
+		{"product", "?product_id=1", []string{"order-1", "order-3"}, 2},
+		{"customer and product", "?customer_id=2&product_id=2", []string{"order-4"}, 1},
+		{"from is inclusive", "?from=2024-01-01T11:30:00Z", []string{"order-2", "order-3"}, 2},
+		{"to is exclusive", "?to=2024-01-01T11:30:00Z", []string{"order-1", "order-4"}, 2},
+		{"from and to", "?from=2024-01-01T10:00:00Z&to=2024-01-02T00:00:00Z", []string{"order-1", "order-4", "order-2"}, 3},
+		{"newest first", "?order=desc", []string{"order-3", "order-2", "order-4", "order-1"}, 4},
+		{"by total price", "?sort=total_price&order=desc", []string{"order-4", "order-2", "order-1", "order-3"}, 4},
+		{"by processed at", "?sort=processed_at", []string{"order-1", "order-2", "order-3", "order-4"}, 4},
+		{"page", "?limit=2&offset=1", []string{"order-4", "order-2"}, 4},
+		{"filtered page", "?customer_id=2&limit=1&offset=1", []string{"order-3"}, 2},
+		{"past the last page", "?offset=10", []string{}, 4},
+		{"no match", "?customer_id=9", []string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.serve("GET", "/reports"+tt.query)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			got := decodeJSON[reportsResponse](t, rr.Body.Bytes())
+			assert.Equal(t, tt.want, orderIDs(got.Reports))
+			assert.Equal(t, tt.wantTotal, got.Total)
+		})
+	}
+}
+
+func TestGetReportsPage(t *testing.T) {
+	ts := newTestReportService(t)
+
+	got := decodeJSON[reportsResponse](t, ts.serve("GET", "/reports").Body.Bytes())
+	assert.Equal(t, defaultReportLimit, got.Limit)
+	assert.Equal(t, 0, got.Offset)
+	assert.NotNil(t, got.Reports)
+
+	got = decodeJSON[reportsResponse](t, ts.serve("GET", "/reports?limit=500&offset=20").Body.Bytes())
+	assert.Equal(t, maxReportLimit, got.Limit)
+	assert.Equal(t, 20, got.Offset)
+}
+
+func TestGetReportsProblems(t *testing.T) {
+	ts := newTestReportService(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"customer is zero", "?customer_id=0"},
+		{"customer is not a number", "?customer_id=one"},
+		{"product is negative", "?product_id=-1"},
+		{"from is not RFC 3339", "?from=2024-01-01"},
+		{"to is not RFC 3339", "?to=yesterday"},
+		{"from after to", "?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z"},
+		{"empty range", "?from=2024-01-01T00:00:00Z&to=2024-01-01T00:00:00Z"},
+		{"limit is zero", "?limit=0"},
+		{"limit above the maximum", "?limit=501"},
+		{"offset is negative", "?offset=-1"},
+		{"unknown sort", "?sort=customer_id"},
+		{"unknown order", "?order=up"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.serve("GET", "/reports"+tt.query)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), `"error"`)
+		})
+	}
+}
+
+func TestGetReport(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	rr := ts.serve("GET", "/reports/order-2")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	report := decodeJSON[OrderReport](t, rr.Body.Bytes())
+	assert.Equal(t, "order-2", report.OrderID)
+	assert.Equal(t, 250, report.TotalPrice)
+	assert.Equal(t, 1, report.CustomerID)
+	assert.Equal(t, 2, report.ProductID)
+	assert.True(t, report.CreatedAt.Equal(time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC)))
+	assert.False(t, report.ProcessedAt.IsZero())
+
+	assert.Equal(t, http.StatusNotFound, ts.serve("GET", "/reports/order-9").Code)
+}
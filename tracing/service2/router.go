@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventRouter consumes topics through a Watermill router. Every message
+// goes through the correlation ID, tracing and logging middlewares, and
+// every handler recovers from panics and times out. The messages being
+// handled when the router shuts down are finished and acked.
+type EventRouter struct {
+	router     *message.Router
+	subscriber message.Subscriber
+	timeout    time.Duration
+	logger     *slog.Logger
+}
+
+func NewEventRouter(subscriber message.Subscriber, tracer trace.Tracer, logger *slog.Logger, timeout, closeTimeout time.Duration) (*EventRouter, error) {
+	router, err := message.NewRouter(message.RouterConfig{CloseTimeout: closeTimeout}, watermill.NewSlogLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+
+	// The router middlewares are added before any handler middleware, so
+	// they run first and once per message, around the retries
+	router.AddMiddleware(
+		detachContext,
+		correlationID,
+		tracing(tracer),
+		logging(logger),
+	)
+
+	return &EventRouter{
+		router:     router,
+		subscriber: openSubscriber{subscriber},
+		timeout:    timeout,
+		logger:     logger,
+	}, nil
+}
+
+// openSubscriber keeps the router from closing the subscriber when it shuts
+// down, which would nack the messages being handled. The router cancels the
+// subscriptions instead, once the current messages are acked, and the
+// subscriber is closed afterwards.
+type openSubscriber struct {
+	message.Subscriber
+}
+
+func (openSubscriber) Close() error {
+	return nil
+}
+
+// Handle registers handler for the messages of topic. The middlewares run
+// in order after the router ones, and each attempt of the handler recovers
+// from panics and gets its own timeout.
+func (r *EventRouter) Handle(name, topic string, handler message.NoPublishHandlerFunc, middlewares ...message.HandlerMiddleware) {
+	middlewares = append(middlewares, middleware.Recoverer, timeout(r.timeout))
+	r.router.AddNoPublisherHandler(name, topic, r.subscriber, handler).AddMiddleware(middlewares...)
+	r.logger.Info("Registered message handler", slog.String("handler", name), slog.String("topic", topic))
+}
+
+// Run starts the router and returns once the handlers are subscribed
+func (r *EventRouter) Run(ctx context.Context) error {
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- r.router.Run(ctx)
+	}()
+
+	select {
+	case <-r.router.Running():
+		r.logger.Info("Message router started, listening for messages")
+		return nil
+	case err := <-runErr:
+		return err
+	}
+}
+
+// Shutdown stops consuming and waits for the messages being handled to be
+// acked, or for ctx to be done
+func (r *EventRouter) Shutdown(ctx context.Context) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- r.router.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+// newTestRouter runs an EventRouter consuming topic with handler, with a
+// handler timeout of timeout
+func newTestRouter(t *testing.T, timeout time.Duration, handler message.NoPublishHandlerFunc, middlewares ...message.HandlerMiddleware) (*EventRouter, *gochannel.GoChannel) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	t.Cleanup(func() { pubSub.Close() })
+
+	router, err := NewEventRouter(pubSub, otel.Tracer("report-service"), logger, timeout, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Handle("test_handler", "events", handler, middlewares...)
+	if err := router.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return router, pubSub
+}
+
+// handled collects what the handler saw of each message
+type handled struct {
+	uuid          string
+	correlationID string
+	handler       string
+	logger        bool
+}
+
+func TestEventRouterMiddlewares(t *testing.T) {
+	results := make(chan handled, 2)
+	router, pubSub := newTestRouter(t, time.Second, func(msg *message.Message) error {
+		ctx := msg.Context()
+		results <- handled{
+			uuid:          msg.UUID,
+			correlationID: middleware.MessageCorrelationID(msg),
+			handler:       message.HandlerNameFromCtx(ctx),
+			logger:        ctx.Value(loggerKey{}) != nil,
+		}
+		return nil
+	})
+	defer router.Shutdown(context.Background())
+
+	// Act
+	withID := message.NewMessage("message-1", nil)
+	middleware.SetCorrelationID("correlation-1", withID)
+	assert.NoError(t, pubSub.Publish("events", withID))
+	assert.NoError(t, pubSub.Publish("events", message.NewMessage("message-2", nil)))
+
+	// Assert, a message without correlation ID gets its own UUID
+	correlationIDs := map[string]string{}
+	for range 2 {
+		select {
+		case got := <-results:
+			correlationIDs[got.uuid] = got.correlationID
+			assert.Equal(t, "test_handler", got.handler)
+			assert.True(t, got.logger)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not handled")
+		}
+	}
+	assert.Equal(t, map[string]string{"message-1": "correlation-1", "message-2": "message-2"}, correlationIDs)
+}
+
+func TestEventRouterRecoversFromPanics(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	done := make(chan struct{})
+	router, pubSub := newTestRouter(t, time.Second, func(msg *message.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			panic("boom")
+		}
+		close(done)
+		return nil
+	})
+	defer router.Shutdown(context.Background())
+
+	assert.NoError(t, pubSub.Publish("events", message.NewMessage("message-1", nil)))
+
+	// The panic nacks the message, which is redelivered
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not redelivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, attempts)
+}
+
+func TestEventRouterTimesOutEachAttempt(t *testing.T) {
+	retry := middleware.Retry{MaxRetries: 2, InitialInterval: time.Millisecond}
+	errs := make(chan error, 3)
+	done := make(chan struct{})
+	router, pubSub := newTestRouter(t, 20*time.Millisecond, func(msg *message.Message) error {
+		<-msg.Context().Done()
+		errs <- msg.Context().Err()
+		if len(errs) == cap(errs) {
+			close(done)
+			return nil
+		}
+		return msg.Context().Err()
+	}, retryTransient(retry))
+	defer router.Shutdown(context.Background())
+
+	assert.NoError(t, pubSub.Publish("events", message.NewMessage("message-1", nil)))
+
+	// Every retried attempt gets its own timeout, not the expired one
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not retried")
+	}
+	for range cap(errs) {
+		assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+	}
+}
+
+func TestEventTypeFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		want      bool
+	}{
+		{"same type", "OrderCreated", true},
+		{"no type", "", true},
+		{"other type", "OrderStatusChanged", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := eventTypeFilter("OrderCreated")(func(msg *message.Message) ([]*message.Message, error) {
+				called = true
+				return nil, nil
+			})
+			msg := message.NewMessage(watermill.NewUUID(), nil)
+			if tt.eventType != "" {
+				msg.Metadata.Set(eventTypeKey, tt.eventType)
+			}
+
+			_, err := handler(msg)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, called)
+		})
+	}
+}
+
+func TestEventRouterShutdownFinishesCurrentMessage(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	results := make(chan error, 1)
+	router, pubSub := newTestRouter(t, 5*time.Second, func(msg *message.Message) error {
+		close(started)
+		<-release
+		results <- msg.Context().Err()
+		return nil
+	})
+	assert.NoError(t, pubSub.Publish("events", message.NewMessage("message-1", nil)))
+	<-started
+
+	// Act
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- router.Shutdown(context.Background())
+	}()
+
+	// Assert, the router waits for the message, whose context is not cancelled
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v before the message was handled", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-results)
+	select {
+	case err := <-shutdown:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+}
+
+func TestEventRouterShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router, pubSub := newTestRouter(t, 5*time.Second, func(msg *message.Message) error {
+		close(started)
+		<-release
+		return nil
+	})
+	defer close(release)
+	assert.NoError(t, pubSub.Publish("events", message.NewMessage("message-1", nil)))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := router.Shutdown(ctx)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+}
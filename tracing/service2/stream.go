@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+	// streamBufferSize events wait for a slow client before it is dropped,
+	// it can reconnect and resume from its last event
+	streamBufferSize = 64
+	streamReplayPage = 500
+)
+
+var (
+	errStreamDropped = errors.New("stream client too slow, dropped")
+	errStreamsClosed = errors.New("report service shutting down")
+)
+
+// ReportFilter selects the reports of a customer or product, zero fields
+// do not filter
+type ReportFilter struct {
+	CustomerID int
+	ProductID  int
+}
+
+func (f ReportFilter) matches(report OrderReport) bool {
+	return (f.CustomerID == 0 || f.CustomerID == report.CustomerID) &&
+		(f.ProductID == 0 || f.ProductID == report.ProductID)
+}
+
+// ReportEvent is pushed to the stream clients for every new report, with
+// the aggregates it updated. ID is the sequence number of the report.
+type ReportEvent struct {
+	ID       int64           `json:"id"`
+	Report   OrderReport     `json:"report"`
+	Customer *CustomerTotals `json:"customer"`
+	Product  *ProductTotals  `json:"product"`
+	Totals   Totals          `json:"totals"`
+}
+
+// ReportBroker fans the report events out to the stream clients
+type ReportBroker struct {
+	mu          sync.Mutex
+	subscribers map[*reportSubscription]struct{}
+	// closed is closed on shutdown to end the streams
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type reportSubscription struct {
+	filter ReportFilter
+	events chan ReportEvent
+	// dropped is closed when the subscription is dropped for falling behind
+	dropped chan struct{}
+}
+
+func NewReportBroker() *ReportBroker {
+	return &ReportBroker{
+		subscribers: make(map[*reportSubscription]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Close ends the streams, they would keep the HTTP server from shutting down
+func (b *ReportBroker) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+func (b *ReportBroker) Subscribe(filter ReportFilter) *reportSubscription {
+	sub := &reportSubscription{
+		filter:  filter,
+		events:  make(chan ReportEvent, streamBufferSize),
+		dropped: make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *ReportBroker) Unsubscribe(sub *reportSubscription) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+}
+
+// Publish sends event to the matching subscribers without blocking, a
+// subscriber with a full buffer is dropped
+func (b *ReportBroker) Publish(event ReportEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.matches(event.Report) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.dropped)
+		}
+	}
+}
+
+// storeReport stores a report and publishes it to the stream clients, it is
+// called with rs.mu held so that the reports are published in the order of
+// their IDs
+func (rs *ReportService) storeReport(ctx context.Context, seq int64, report OrderReport) (bool, error) {
+	stored, err := rs.store.Save(ctx, seq, report)
+	if err != nil || !stored {
+		return stored, err
+	}
+
+	event, err := rs.newReportEvent(ctx, seq, report)
+	if err != nil {
+		// The report is stored, the stream clients get it when they resume
+		messageLogger(ctx, rs.logger).ErrorContext(ctx, "Failed to publish order report to the streams",
+			slog.String("error", err.Error()),
+			slog.String("order_id", report.OrderID),
+		)
+		return true, nil
+	}
+	rs.broker.Publish(event)
+	return true, nil
+}
+
+// newReportEvent reads the aggregates updated by a report
+func (rs *ReportService) newReportEvent(ctx context.Context, seq int64, report OrderReport) (ReportEvent, error) {
+	event := ReportEvent{ID: seq, Report: report}
+	var err error
+	if event.Customer, err = rs.store.CustomerTotals(ctx, report.CustomerID); err != nil {
+		return event, err
+	}
+	if event.Product, err = rs.store.ProductTotals(ctx, report.ProductID); err != nil {
+		return event, err
+	}
+	if event.Totals, err = rs.store.Totals(ctx); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// streamReports sends the reports of filter stored after lastID, then the
+// new ones as they are stored, and a heartbeat when there is none for a
+// while. It returns when ctx is done, sending fails or the broker closes.
+func (rs *ReportService) streamReports(ctx context.Context, filter ReportFilter, lastID int64,
+	send func(ReportEvent) error, heartbeat func() error) error {
+	// Subscribe before reading the stored reports so that none is missed,
+	// the new reports read from both are skipped by their ID
+	sub := rs.broker.Subscribe(filter)
+	defer rs.broker.Unsubscribe(sub)
+
+	for {
+		reports, err := rs.store.ReportsAfter(ctx, lastID, filter, streamReplayPage)
+		if err != nil {
+			return err
+		}
+		for _, sequenced := range reports {
+			event, err := rs.newReportEvent(ctx, sequenced.Seq, sequenced.Report)
+			if err != nil {
+				return err
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			lastID = sequenced.Seq
+		}
+		if len(reports) < streamReplayPage {
+			break
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-rs.broker.closed:
+			return errStreamsClosed
+		case <-sub.dropped:
+			return errStreamDropped
+		case event := <-sub.events:
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			lastID = event.ID
+			ticker.Reset(streamHeartbeatInterval)
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseStreamRequest reads the filter of a stream and the ID of the last
+// event the client received, from the Last-Event-ID header or the
+// last_event_id query parameter
+func parseStreamRequest(c *gin.Context) (ReportFilter, int64, error) {
+	var filter ReportFilter
+	var err error
+	if filter.CustomerID, err = positiveQueryInt(c, "customer_id", 0); err != nil {
+		return filter, 0, err
+	}
+	if filter.ProductID, err = positiveQueryInt(c, "product_id", 0); err != nil {
+		return filter, 0, err
+	}
+
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return filter, 0, nil
+	}
+	lastID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || lastID < 0 {
+		return filter, 0, errors.New("last event ID must be a non-negative integer")
+	}
+	return filter, lastID, nil
+}
+
+// streamSSE streams the reports as Server-Sent Events, each one with its ID
+// so that EventSource resumes from it on reconnection
+func (rs *ReportService) streamSSE(c *gin.Context) {
+	filter, lastID, err := parseStreamRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(event ReportEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: report\ndata: %s\n\n", event.ID, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	rs.logger.Info("Report stream opened", slog.String("transport", "sse"), slog.Int64("last_event_id", lastID))
+	err = rs.streamReports(c.Request.Context(), filter, lastID, send, heartbeat)
+	rs.logStreamClosed("sse", err)
+}
+
+var upgrader = websocket.Upgrader{
+	// The dashboards are served from other origins
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamWebSocket streams the reports as JSON text messages, with a ping
+// as heartbeat. The client resumes with the last_event_id query parameter.
+func (rs *ReportService) streamWebSocket(c *gin.Context) {
+	filter, lastID, err := parseStreamRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has written the error response
+		rs.logger.Warn("Failed to upgrade report stream", slog.String("error", err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	// Read the connection so that pongs and the close frame are handled,
+	// the stream stops when the client goes away
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event ReportEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(event)
+	}
+	heartbeat := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+	}
+
+	rs.logger.Info("Report stream opened", slog.String("transport", "websocket"), slog.Int64("last_event_id", lastID))
+	err = rs.streamReports(ctx, filter, lastID, send, heartbeat)
+	switch {
+	case errors.Is(err, errStreamDropped):
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(streamWriteTimeout))
+	case errors.Is(err, errStreamsClosed):
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, err.Error()),
+			time.Now().Add(streamWriteTimeout))
+	}
+	rs.logStreamClosed("websocket", err)
+}
+
+func (rs *ReportService) logStreamClosed(transport string, err error) {
+	if err != nil && !errors.Is(err, errStreamsClosed) {
+		rs.logger.Warn("Report stream closed", slog.String("transport", transport), slog.String("error", err.Error()))
+		return
+	}
+	rs.logger.Info("Report stream closed", slog.String("transport", transport))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStream runs streamReports in the background and collects what it sends
+type testStream struct {
+	events chan ReportEvent
+	done   chan error
+	cancel context.CancelFunc
+}
+
+func (ts *testReportService) stream(filter ReportFilter, lastID int64, send func(ReportEvent) error) *testStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &testStream{
+		events: make(chan ReportEvent, 2*streamBufferSize),
+		done:   make(chan error, 1),
+		cancel: cancel,
+	}
+	if send == nil {
+		send = func(event ReportEvent) error {
+			s.events <- event
+			return nil
+		}
+	}
+	heartbeat := func() error { return nil }
+	go func() {
+		s.done <- ts.streamReports(ctx, filter, lastID, send, heartbeat)
+	}()
+	return s
+}
+
+// next returns the ID of the next event sent
+func (s *testStream) next(t *testing.T) int64 {
+	t.Helper()
+	select {
+	case event := <-s.events:
+		return event.ID
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event sent")
+		return 0
+	}
+}
+
+func (s *testStream) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-s.done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end")
+		return nil
+	}
+}
+
+// waitForSubscribers waits for n streams to subscribe to the broker
+func (ts *testReportService) waitForSubscribers(t *testing.T, n int) {
+	assert.Eventually(t, func() bool {
+		ts.broker.mu.Lock()
+		defer ts.broker.mu.Unlock()
+		return len(ts.broker.subscribers) == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestStreamReportsResumes(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ReportFilter
+		lastID int64
+		want   []int64
+	}{
+		{"from the start", ReportFilter{}, 0, []int64{1, 2, 3, 4, 5}},
+		{"after the last event", ReportFilter{}, 2, []int64{3, 4, 5}},
+		{"up to date", ReportFilter{}, 4, []int64{5}},
+		{"customer", ReportFilter{CustomerID: 1}, 0, []int64{1, 2, 5}},
+		{"product after the last event", ReportFilter{ProductID: 2}, 2, []int64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestReportService(t)
+			ts.consumeTestOrders(t)
+
+			// Act, replay the stored reports then send a new one
+			stream := ts.stream(tt.filter, tt.lastID, nil)
+			ts.waitForSubscribers(t, 1)
+			ts.consume(t, "message-5", OrderCreatedEvent{OrderID: "order-5", TotalPrice: 40, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-03T08:00:00Z"})
+
+			// Assert
+			var got []int64
+			for range tt.want {
+				got = append(got, stream.next(t))
+			}
+			assert.Equal(t, tt.want, got)
+
+			stream.cancel()
+			assert.NoError(t, stream.wait(t))
+			assert.Empty(t, stream.events)
+			ts.waitForSubscribers(t, 0)
+		})
+	}
+}
+
+func TestStreamReportsEvent(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+	stream := ts.stream(ReportFilter{}, 3, nil)
+	defer stream.cancel()
+
+	event := <-stream.events
+
+	// The event carries the aggregates as of the report
+	assert.Equal(t, int64(4), event.ID)
+	assert.Equal(t, "order-4", event.Report.OrderID)
+	assert.Equal(t, Totals{OrderCount: 2, Revenue: 350, AverageOrderValue: 175}, event.Customer.Totals)
+	assert.Equal(t, Totals{OrderCount: 2, Revenue: 550, AverageOrderValue: 275}, event.Product.Totals)
+	assert.Equal(t, Totals{OrderCount: 4, Revenue: 700, AverageOrderValue: 175}, event.Totals)
+}
+
+func TestStreamReportsSkipsReplayedEvents(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+
+	// Setup, a report replayed from the store is also published to the
+	// stream, as when it is stored between the subscription and the replay
+	events := make(chan ReportEvent, 2*streamBufferSize)
+	stream := ts.stream(ReportFilter{}, 0, func(event ReportEvent) error {
+		if event.ID == 2 {
+			ts.broker.Publish(event)
+		}
+		events <- event
+		return nil
+	})
+	stream.events = events
+	defer stream.cancel()
+	for _, want := range []int64{1, 2, 3, 4} {
+		assert.Equal(t, want, stream.next(t))
+	}
+
+	// Act
+	ts.consume(t, "message-5", OrderCreatedEvent{OrderID: "order-5", TotalPrice: 40, CustomerID: 1, ProductID: 1, CreatedAt: "2024-01-03T08:00:00Z"})
+
+	// Assert, the published copy of report 2 was skipped
+	assert.Equal(t, int64(5), stream.next(t))
+}
+
+func TestStreamReportsDropsSlowClients(t *testing.T) {
+	ts := newTestReportService(t)
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	stream := ts.stream(ReportFilter{}, 0, func(event ReportEvent) error {
+		if event.ID == 1 {
+			close(sending)
+			<-release
+		}
+		return nil
+	})
+	defer stream.cancel()
+	ts.waitForSubscribers(t, 1)
+
+	// Act, the client is stuck on the first event while the buffer fills up
+	ts.broker.Publish(ReportEvent{ID: 1})
+	<-sending
+	for id := int64(2); id <= streamBufferSize+2; id++ {
+		ts.broker.Publish(ReportEvent{ID: id})
+	}
+	close(release)
+
+	// Assert
+	assert.ErrorIs(t, stream.wait(t), errStreamDropped)
+	ts.waitForSubscribers(t, 0)
+}
+
+func TestStreamReportsEnds(t *testing.T) {
+	errSend := errors.New("connection reset")
+	tests := []struct {
+		name string
+		end  func(t *testing.T, ts *testReportService)
+		send func(ReportEvent) error
+		want error
+	}{
+		{
+			name: "broker closed",
+			end:  func(t *testing.T, ts *testReportService) { ts.broker.Close() },
+			want: errStreamsClosed,
+		},
+		{
+			name: "send fails",
+			end: func(t *testing.T, ts *testReportService) {
+				ts.consume(t, "message-1", testOrders[0])
+			},
+			send: func(ReportEvent) error { return errSend },
+			want: errSend,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestReportService(t)
+			stream := ts.stream(ReportFilter{}, 0, tt.send)
+			defer stream.cancel()
+			ts.waitForSubscribers(t, 1)
+
+			tt.end(t, ts)
+
+			assert.ErrorIs(t, stream.wait(t), tt.want)
+		})
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	ts := newTestReportService(t)
+	ts.consumeTestOrders(t)
+	// The stream ends after the replay
+	ts.broker.Close()
+	eventIDs := regexp.MustCompile(`(?m)^id: (\d+)$`)
+
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   []string
+	}{
+		{"from the start", "", "", []string{"1", "2", "3", "4"}},
+		{"Last-Event-ID header", "", "2", []string{"3", "4"}},
+		{"last_event_id parameter", "?last_event_id=3", "", []string{"4"}},
+		{"header before parameter", "?last_event_id=1", "3", []string{"4"}},
+		{"filtered", "?customer_id=2", "", []string{"3", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/reports/stream"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			ts.handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+			var got []string
+			for _, match := range eventIDs.FindAllStringSubmatch(rr.Body.String(), -1) {
+				got = append(got, match[1])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStreamProblems(t *testing.T) {
+	ts := newTestReportService(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		header string
+	}{
+		{"Last-Event-ID is negative", "", "-1"},
+		{"Last-Event-ID is not a number", "", "abc"},
+		{"last_event_id is not a number", "?last_event_id=x", ""},
+		{"customer is zero", "?customer_id=0", ""},
+		{"product is not a number", "?product_id=one", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/reports/stream", "/reports/ws"} {
+				req := httptest.NewRequest("GET", path+tt.query, nil)
+				if tt.header != "" {
+					req.Header.Set("Last-Event-ID", tt.header)
+				}
+				rr := httptest.NewRecorder()
+
+				ts.handler.ServeHTTP(rr, req)
+
+				assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+			}
+		})
+	}
+}
@@ -7,9 +7,9 @@ echo "Creating a test order..."
 curl -X POST http://localhost:8080/order \
   -H "Content-Type: application/json" \
   -d '{
-    "total_price": 1000,
     "customer_id": 1,
-    "product_id": 1
+    "product_id": 1,
+    "quantity": 10
   }'
 
 echo -e "\n\nWaiting 2 seconds for message processing..."
@@ -23,9 +23,8 @@ echo -e "\n\nCreating another order..."
 curl -X POST http://localhost:8080/order \
   -H "Content-Type: application/json" \
   -d '{
-    "total_price": 2500,
     "customer_id": 2,
-    "product_id": 3
+    "product_id": 2
   }'
 
 echo -e "\n\nWaiting 2 seconds for message processing..."
@@ -35,6 +34,14 @@ sleep 2
 echo "Checking updated reports..."
 curl -X GET http://localhost:8081/reports
 
+echo -e "\n\nCreating an order for an unknown product (expect 422)..."
+curl -X POST http://localhost:8080/order \
+  -H "Content-Type: application/json" \
+  -d '{
+    "customer_id": 3,
+    "product_id": 999
+  }'
+
 echo -e "\n\nTest completed!"
 echo "Check Jaeger UI at: http://localhost:16686"
 echo "Check RabbitMQ UI at: http://localhost:15672 (guest/guest)"
\ No newline at end of file